@@ -0,0 +1,31 @@
+package main
+
+import "time"
+
+// whether autosave is on and the buffer is something it may write
+func (e *Editor) canAutosave() bool {
+	return settings.Autosave > 0 && filename != "" && !e.readOnly
+}
+
+// saving a modified buffer once no key has been pressed for settings.Autosave seconds.
+// The onSave transforms don't run, they would tidy away what is being typed (like
+// the space after a word), and a failed save is not tried again until the buffer changes.
+func (e *Editor) autosave() {
+	if !e.canAutosave() || !e.Modified() || e.stateID() == e.autosaveFailed {
+		return
+	}
+	if time.Since(e.lastInput) < time.Duration(settings.Autosave)*time.Second {
+		return
+	}
+	if changed, _ := e.diskChanged(); changed {
+		// checkDisk asks about that, and the file on disk isn't written over without an answer
+		return
+	}
+	if err := e.writeBuffer(); err != nil {
+		e.autosaveFailed = e.stateID()
+		e.message = "autosave failed: " + err.Error()
+		return
+	}
+	e.autosaveFailed = -1
+	e.message = "autosaved " + filename
+}
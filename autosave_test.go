@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestAutosaveOnQuitDoesNotTidy(t *testing.T) {
+	path := setupUndoFile(t)
+	old := settings
+	t.Cleanup(func() { settings = old })
+	settings.Autosave = 5
+	settings.OnSave = []string{"trimTrailingWhitespace"}
+	e := openTest(t, path)
+	e.edit(5, 0, " ")
+	if !e.confirmQuit() {
+		t.Fatal("quitting was refused")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello \n" {
+		t.Errorf("the file was saved as %q", data)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Before a save overwrites a file, the version on disk can be copied somewhere
+// safe. With "backup": "tilde" that is name~ next to the file, like vim does,
+// and with "backup": "dir" it is a timestamped copy in the backup directory, of
+// which the newest "backupKeep" are kept.
+
+// the layout of the timestamp in the names of backups in the backup directory, it sorts by time
+const backupTime = "20060102-150405.000"
+
+// the directory timestamped backups go in
+func backupDir() (string, error) {
+	if settings.BackupDir != "" {
+		return settings.BackupDir, os.MkdirAll(settings.BackupDir, 0700)
+	}
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "backup")
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+// the start of the names of the backups of path in the backup directory
+func backupPrefix(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	return escapePath(abs) + "@"
+}
+
+// copying the open file on disk to a backup before it is overwritten
+func (e *Editor) backup() error {
+	var dest string
+	if e.format.Encrypted {
+		// a copy would outlive a change of passphrase, so there are no backups of encrypted files
+		return nil
+	}
+	switch settings.Backup {
+	case "", "off":
+		return nil
+	case "tilde":
+		dest = filename + "~"
+	case "dir":
+		dir, err := backupDir()
+		if err != nil {
+			return err
+		}
+		dest = filepath.Join(dir, backupPrefix(filename)+time.Now().Format(backupTime))
+	default:
+		return fmt.Errorf("unknown backup setting %q, it can be off, tilde or dir", settings.Backup)
+	}
+	src, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		// nothing to lose yet
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	err = writeFileFrom(dest, info.Mode().Perm(), func(w io.Writer) error {
+		_, err := io.Copy(w, src)
+		return err
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if settings.Backup == "dir" {
+		pruneBackups(filename)
+	}
+	return nil
+}
+
+// the backups of path, newest first
+func listBackups(path string) []string {
+	if settings.Backup == "tilde" {
+		if _, err := os.Stat(path + "~"); err == nil {
+			return []string{path + "~"}
+		}
+		return nil
+	}
+	dir, err := backupDir()
+	if err != nil {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	prefix := backupPrefix(path)
+	var backups []string
+	for _, entry := range entries {
+		// the rest has to be the timestamp, or a backup of path@x would count as one of path
+		stamp, ok := strings.CutPrefix(entry.Name(), prefix)
+		if _, err := time.Parse(backupTime, stamp); ok && err == nil {
+			backups = append(backups, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	return backups
+}
+
+// removing the oldest backups of path beyond the number that are kept
+func pruneBackups(path string) {
+	keep := settings.BackupKeep
+	if keep <= 0 {
+		return
+	}
+	backups := listBackups(path)
+	for _, old := range backups[min(keep, len(backups)):] {
+		os.Remove(old)
+	}
+}
+
+// showing the backups of the open file, numbered for the restore command
+func (e *Editor) showBackups() {
+	if filename == "" {
+		e.message = "the buffer has no file name, so it has no backups"
+		return
+	}
+	backups := listBackups(filename)
+	if len(backups) == 0 {
+		e.message = "no backups of " + filename
+		return
+	}
+	lines := make([]string, len(backups))
+	for i, backup := range backups {
+		lines[i] = fmt.Sprintf("%3d  ", i+1)
+		if info, err := os.Stat(backup); err == nil {
+			lines[i] += fmt.Sprintf("%s  %8d bytes  ", info.ModTime().Format("2006-01-02 15:04:05"), info.Size())
+		}
+		lines[i] += backup
+	}
+	e.ShowText("backups of "+filename+", restore N puts one in the buffer", lines)
+}
+
+// putting backup number n of the open file in the buffer, as a change that can be undone or saved
+func (e *Editor) restoreBackup(args []string) {
+	if len(args) != 1 {
+		e.message = "usage: restore N, the backups command lists them"
+		return
+	}
+	n, err := strconv.Atoi(args[0])
+	backups := listBackups(filename)
+	if err != nil || n < 1 || n > len(backups) {
+		e.message = "there is no backup " + args[0]
+		return
+	}
+	if e.refuseEdit() {
+		return
+	}
+	if e.largeFile {
+		// the buffer is saved byte for byte, and a backup as big would have to be read into memory
+		e.message = "large files can't be restored here, open " + backups[n-1] + " instead"
+		return
+	}
+	raw, err := os.ReadFile(backups[n-1])
+	if err != nil {
+		e.message = readError(backups[n-1], err).Error()
+		return
+	}
+	// the backup is a copy of the file on disk, compressed if the file is
+	data, _, _, err := e.unpack(backups[n-1], raw)
+	var notCompressed *notCompressedError
+	if err != nil && !errors.As(err, &notCompressed) {
+		e.message = readError(backups[n-1], err).Error()
+		return
+	}
+	if e.hex != nil {
+		// the hex view holds the bytes as they are, nothing is decoded
+		e.edit(0, e.buffer.Len(), string(data))
+		e.hexMove(0)
+		e.message = "restored " + backups[n-1] + ", save to keep it"
+		return
+	}
+	text, format := decodeFile(data)
+	// undoing the restore puts the line endings and encoding back too
+	e.editFormat(format, func() { e.edit(0, e.buffer.Len(), text) })
+	e.setCursor(0, 0)
+	e.message = "restored " + backups[n-1] + ", save to keep it"
+}
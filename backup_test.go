@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// backups into a directory of the test's own, with the settings put back after
+func setupBackups(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	old, oldName := settings, filename
+	t.Cleanup(func() { settings, filename = old, oldName })
+	settings.Backup = "dir"
+	settings.BackupDir = t.TempDir()
+}
+
+func TestRestoreCompressedBackup(t *testing.T) {
+	setupBackups(t)
+	path := filepath.Join(t.TempDir(), "notes.txt.gz")
+	data, err := compress([]byte("first version\n"), "gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := openTest(t, path)
+	e.editAll("second version\n")
+	if err := e.SaveFile(); err != nil {
+		t.Fatal(err)
+	}
+	e.restoreBackup([]string{"1"})
+	if got := e.buffer.String(); got != "first version\n" {
+		t.Errorf("restored %q", got)
+	}
+	if e.format.Compression != "gzip" {
+		t.Errorf("the restored buffer is saved with compression %q", e.format.Compression)
+	}
+}
+
+func TestRestoreBackupInHexView(t *testing.T) {
+	setupBackups(t)
+	path := filepath.Join(t.TempDir(), "data.bin")
+	first := "\x00\x01\r\n\xff\xfe\r\x00"
+	if err := os.WriteFile(path, []byte(first), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := openTest(t, path)
+	if e.hex == nil {
+		t.Fatal("the binary file didn't open in the hex view")
+	}
+	e.edit(0, 1, "\x07")
+	if err := e.SaveFile(); err != nil {
+		t.Fatal(err)
+	}
+	e.restoreBackup([]string{"1"})
+	if got := e.buffer.String(); got != first {
+		t.Errorf("restored % x, want % x", got, first)
+	}
+	if e.format != defaultFormat {
+		t.Errorf("restoring changed the format to %+v", e.format)
+	}
+}
+
+func TestBackupsAreOnlyTheFilesOwn(t *testing.T) {
+	setupBackups(t)
+	dir := t.TempDir()
+	// a and a@x used to share backups, as did the ones with x and y
+	paths := []string{
+		filepath.Join(dir, "a"),
+		filepath.Join(dir, "a@x"),
+		filepath.Join(dir, "x", "y"),
+		filepath.Join(dir, "x%y"),
+	}
+	if runtime.GOOS != "windows" {
+		paths = append(paths, filepath.Join(dir, "x:y"))
+	}
+	if err := os.Mkdir(filepath.Join(dir, "x"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		if err := os.WriteFile(path, []byte(path), 0644); err != nil {
+			t.Fatal(err)
+		}
+		e := openTest(t, path)
+		e.editAll("changed\n")
+		if err := e.SaveFile(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, path := range paths {
+		backups := listBackups(path)
+		if len(backups) != 1 {
+			t.Errorf("%s has backups %v, want one", path, backups)
+			continue
+		}
+		if data, _ := os.ReadFile(backups[0]); string(data) != path {
+			t.Errorf("the backup of %s holds %q", path, data)
+		}
+	}
+}
+
+func TestUndoRestoredFormat(t *testing.T) {
+	setupBackups(t)
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("one\r\ntwo\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := openTest(t, path)
+	e.RunCommand("lineending lf")
+	if err := e.SaveFile(); err != nil {
+		t.Fatal(err)
+	}
+	e.restoreBackup([]string{"1"})
+	if e.format.LineEnding != "\r\n" {
+		t.Fatalf("the restored backup is written with %q", e.format.LineEnding)
+	}
+	e.Undo()
+	if e.format.LineEnding != "\n" || e.Modified() {
+		t.Errorf("undoing the restore left line endings %q, modified %v", e.format.LineEnding, e.Modified())
+	}
+}
+
+func TestNoRestoreInLargeFile(t *testing.T) {
+	setupBackups(t)
+	settings.LargeFileSize = 1 << 10
+	path := filepath.Join(t.TempDir(), "big.log")
+	text := strings.Repeat("a line\r\n", 200)
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := openTest(t, path)
+	e.edit(0, 0, "x")
+	if err := e.SaveFile(); err != nil {
+		t.Fatal(err)
+	}
+	e.restoreBackup([]string{"1"})
+	if got := e.buffer.String(); got != "x"+text {
+		t.Errorf("the large file was changed to %d bytes by restoring", len(got))
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+// opening path in the editor, a directory opens the file browser to pick a file from it
+func (e *Editor) Open(path string) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		chosen, ok := e.Browse(path)
+		if !ok {
+			e.message = "no file opened"
+			return
+		}
+		path = chosen
+	}
+	if err := e.ReadFile(path); err != nil {
+		// nothing is named after the file, so saving can't write over what couldn't be read
+		e.message = err.Error()
+		return
+	}
+	filename = path
+	// a file that doesn't exist yet is created by the first save, so only an existing one can be read-only
+	_, err := os.Stat(path)
+	e.readOnly = openReadOnly || err == nil && !writable(path)
+	if e.readOnly && !openReadOnly {
+		e.message = "you don't have permission to write to " + path + ", the buffer is read-only"
+	}
+	if e.format.Compression == "bzip2" {
+		e.readOnly = true
+		e.message = "bzip2 files can only be read, Ctrl+O saves to another file"
+	}
+	e.readUndo()
+}
+
+// the entries of a directory for the browser, directories first and each group sorted by name
+func browseEntries(dir string) ([]os.DirEntry, error) {
+	entries, err := os.ReadDir(dir)
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].IsDir() != entries[j].IsDir() {
+			return entries[i].IsDir()
+		}
+		return strings.ToLower(entries[i].Name()) < strings.ToLower(entries[j].Name())
+	})
+	return entries, err
+}
+
+// showing the files in dir full screen and returning the one that is picked. Enter
+// opens a file or goes into a directory, Backspace goes up, n asks for the name of
+// a new file and Esc gives up.
+func (e *Editor) Browse(dir string) (string, bool) {
+	// an absolute path so going up doesn't stop at .
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	entries, err := browseEntries(dir)
+	selected, top := 0, 0
+	for {
+		width, height := termbox.Size()
+		rows := height - 1
+		termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+		// the first row is always .. so the parent directory can be picked like any other
+		for i := 0; i < rows && top+i <= len(entries); i++ {
+			name, color := "..", termbox.ColorBlue
+			if top+i > 0 {
+				entry := entries[top+i-1]
+				name, color = entry.Name(), termbox.ColorDefault
+				if entry.IsDir() {
+					name, color = name+string(filepath.Separator), termbox.ColorBlue
+				}
+			}
+			bg := termbox.ColorDefault
+			if top+i == selected {
+				bg = termbox.ColorWhite
+				if color == termbox.ColorDefault {
+					color = termbox.ColorBlack
+				}
+				for j := 0; j < width; j++ {
+					termbox.SetCell(j, i, ' ', color, bg)
+				}
+			}
+			drawString(0, i, width, name, color, bg)
+		}
+		for j := 0; j < width; j++ {
+			termbox.SetCell(j, height-1, ' ', termbox.ColorBlack, termbox.ColorWhite)
+		}
+		status := dir + " | Enter to open, Backspace to go up, n for a new file, Esc to cancel"
+		if err != nil {
+			status = readError(dir, err).Error()
+		}
+		drawString(0, height-1, width, status, termbox.ColorBlack, termbox.ColorWhite)
+		termbox.HideCursor()
+		termbox.Flush()
+
+		ev := pollEvent()
+		if ev.Type == termbox.EventError {
+			return "", false
+		}
+		if ev.Type != termbox.EventKey {
+			continue
+		}
+		// where to go next, if anywhere
+		next := ""
+		switch {
+		case ev.Key == termbox.KeyEsc:
+			return "", false
+		case ev.Key == termbox.KeyArrowUp && selected > 0:
+			selected--
+		case ev.Key == termbox.KeyArrowDown && selected < len(entries):
+			selected++
+		case ev.Key == termbox.KeyPgup:
+			selected = max(selected-rows, 0)
+		case ev.Key == termbox.KeyPgdn:
+			selected = min(selected+rows, len(entries))
+		case ev.Key == termbox.KeyBackspace || ev.Key == termbox.KeyBackspace2:
+			next = filepath.Dir(dir)
+		case ev.Key == termbox.KeyEnter && selected == 0:
+			next = filepath.Dir(dir)
+		case ev.Key == termbox.KeyEnter:
+			entry := entries[selected-1]
+			path := filepath.Join(dir, entry.Name())
+			if !entry.IsDir() {
+				// a symlink to a directory is listed as a file, so look at what it points to
+				if info, err := os.Stat(path); err != nil || !info.IsDir() {
+					return path, true
+				}
+			}
+			next = path
+		case ev.Ch == 'n':
+			name, ok := e.PromptFile("new file: ", dir+string(filepath.Separator))
+			if ok && name != "" && !strings.HasSuffix(name, string(filepath.Separator)) {
+				return name, true
+			}
+		}
+		if next != "" && next != dir {
+			dir = next
+			entries, err = browseEntries(dir)
+			selected, top = 0, 0
+		}
+		// keep the selected entry on the screen
+		if selected < top {
+			top = selected
+		} else if selected >= top+rows {
+			top = selected - rows + 1
+		}
+	}
+}
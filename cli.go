@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// the version printed by -version, release builds set it with
+// go build -ldflags "-X main.version=v1.2.3"
+var version = "dev"
+
+// set by -R, every file is opened read-only
+var openReadOnly bool
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "usage: slik [flags] [+LINE] [file[:line[:col]]]...")
+	fmt.Fprintln(out, "       cmd | slik [-filter] -")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "+LINE opens the file after it at that line, file:line:col is understood")
+	fmt.Fprintln(out, "the way compilers and grep -n print it. The commands next, prev and files")
+	fmt.Fprintln(out, "move between the files that were given.")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "flags:")
+	flag.PrintDefaults()
+}
+
+// a file from the command line and where to put the cursor in it, line and col count from 1 and 0 means unset
+type fileArg struct {
+	path string
+	line int
+	col  int
+}
+
+// turning the arguments after the flags into the files to open
+func parseFileArgs(args []string) []fileArg {
+	var files []fileArg
+	line := 0
+	for _, arg := range args {
+		if n, err := strconv.Atoi(strings.TrimPrefix(arg, "+")); strings.HasPrefix(arg, "+") && err == nil {
+			// +LINE goes with the file after it
+			line = n
+			continue
+		}
+		file := splitPosition(arg)
+		if file.line == 0 {
+			file.line = line
+		}
+		line = 0
+		files = append(files, file)
+	}
+	return files
+}
+
+// splitting file:line:col into its parts. A file that really has such a name is
+// left alone, and the colon of a Windows drive is never taken for a position.
+func splitPosition(arg string) fileArg {
+	if _, err := os.Stat(arg); err == nil {
+		return fileArg{path: arg}
+	}
+	// compilers and grep put a colon after the position too
+	rest := strings.TrimSuffix(arg, ":")
+	var numbers []int
+	for len(numbers) < 2 {
+		i := strings.LastIndexByte(rest, ':')
+		if i <= 0 {
+			break
+		}
+		n, err := strconv.Atoi(rest[i+1:])
+		if err != nil || n < 1 {
+			break
+		}
+		numbers = append([]int{n}, numbers...)
+		rest = rest[:i]
+	}
+	switch len(numbers) {
+	case 1:
+		return fileArg{path: rest, line: numbers[0]}
+	case 2:
+		return fileArg{path: rest, line: numbers[0], col: numbers[1]}
+	}
+	return fileArg{path: arg}
+}
+
+// opening one of the files from the command line with a fresh buffer and history
+func (e *Editor) openArg(index int) {
+	fresh := NewEditor()
+	// things that belong to the session rather than the file
+	fresh.filter = e.filter
+	fresh.filterWrite = e.filterWrite
+	fresh.lastSearch = e.lastSearch
+	fresh.files = e.files
+	fresh.fileIndex = index
+	e.unmap()
+	*e = *fresh
+	filename = ""
+
+	file := e.files[index]
+	e.Open(file.path)
+	if filename == "" {
+		return
+	}
+	e.checkSwap()
+	if file.line > 0 {
+		e.jumpTo(file.line, file.col)
+	}
+}
+
+// moving to the file delta places away in the list from the command line
+func (e *Editor) switchFile(delta int) {
+	index := e.fileIndex + delta
+	if index < 0 || index >= len(e.files) {
+		e.message = "no more files"
+		return
+	}
+	if !e.confirmSave("switching files") {
+		return
+	}
+	e.writeUndo()
+	e.removeSwap()
+	e.openArg(index)
+}
+
+// the files from the command line with the open one marked, for the stat bar
+func (e *Editor) listFiles() string {
+	if len(e.files) == 0 {
+		return "no files were given on the command line"
+	}
+	names := make([]string, len(e.files))
+	for i, file := range e.files {
+		names[i] = file.path
+		if i == e.fileIndex {
+			names[i] = "[" + names[i] + "]"
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+// moving the cursor to a line and byte column counted from 1, the way compilers number them
+func (e *Editor) jumpTo(line, col int) {
+	if !e.buffer.HasLine(line - 1) {
+		// past the end goes to the last line, like most editors do with +LINE
+		line = e.buffer.LineCount()
+	}
+	e.GotoLine(line)
+	if col > 1 {
+		text := e.buffer.Line(line - 1)
+		x := min(col-1, len(text))
+		// don't land in the middle of a character
+		if x < len(text) {
+			x = prevBoundary(text, nextBoundary(text, x))
+		}
+		e.setCursor(line-1, x)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// running a command typed at the Ctrl+E prompt, the result is shown on the stat bar
+func (e *Editor) RunCommand(command string) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return
+	}
+	args := fields[1:]
+	switch fields[0] {
+	case "lineending", "le", "encoding", "enc":
+		if e.largeFile || e.hex != nil {
+			// these are saved byte for byte as they were read
+			e.message = "can't change the format of a large file or the hex view"
+			return
+		}
+		if fields[0] == "lineending" || fields[0] == "le" {
+			e.setLineEnding(args)
+		} else {
+			e.setEncoding(args)
+		}
+	case "saveas":
+		e.SaveAs(strings.Join(args, " "))
+	case "goto":
+		if e.hex != nil {
+			e.hexGoto(strings.Join(args, ""))
+			return
+		}
+		line, err := strconv.Atoi(strings.Join(args, ""))
+		if err != nil {
+			e.message = "usage: goto LINE"
+			return
+		}
+		e.GotoLine(line)
+	case "next", "n":
+		e.switchFile(1)
+	case "prev", "p":
+		e.switchFile(-1)
+	case "readonly", "ro":
+		e.readOnly = !e.readOnly
+		if e.readOnly {
+			e.message = "the buffer is read-only"
+		} else {
+			e.message = "the buffer can be edited"
+		}
+	case "backups":
+		e.showBackups()
+	case "restore":
+		e.restoreBackup(args)
+	case "files":
+		e.message = e.listFiles()
+	case "find":
+		text := strings.TrimPrefix(strings.TrimSpace(command), "find ")
+		if e.hex != nil {
+			e.hexFind(text)
+			return
+		}
+		e.Find(text)
+	case "replace":
+		if e.hex != nil {
+			e.message = "replace doesn't work in the hex view"
+			return
+		}
+		if len(args) == 0 {
+			e.message = "usage: replace OLD [NEW]"
+			return
+		}
+		rest := strings.TrimPrefix(strings.TrimLeft(command, " "), "replace ")
+		old, text, _ := strings.Cut(strings.TrimLeft(rest, " "), " ")
+		e.replaceAll(old, text)
+	case "undotree", "ut":
+		e.UndoTree()
+	case "branch":
+		e.nextBranch()
+	case "older", "newer":
+		n := 1
+		if len(args) > 0 {
+			var err error
+			if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+				e.message = "usage: " + fields[0] + " [N]"
+				return
+			}
+		}
+		if fields[0] == "older" {
+			n = -n
+		}
+		e.stepState(n)
+	case "earlier", "later":
+		if len(args) != 1 {
+			e.message = "usage: " + fields[0] + " 10m|1h|2d|N"
+			return
+		}
+		sign := 1
+		if fields[0] == "earlier" {
+			sign = -1
+		}
+		// a plain number counts states, like older and newer
+		if n, err := strconv.Atoi(args[0]); err == nil && n > 0 {
+			e.stepState(sign * n)
+			return
+		}
+		d, err := parseAge(args[0])
+		if err != nil || d <= 0 {
+			e.message = "usage: " + fields[0] + " 10m|1h|2d|N"
+			return
+		}
+		e.stepTime(time.Duration(sign) * d)
+	case "encrypt":
+		e.encryptBuffer()
+	case "decrypt":
+		e.decryptBuffer()
+	case "hex":
+		e.toggleHex()
+	default:
+		e.message = "unknown command: " + fields[0]
+	}
+}
+
+// lineending lf|crlf|cr changes the line endings the file is saved with
+func (e *Editor) setLineEnding(args []string) {
+	if len(args) != 1 {
+		e.message = "usage: lineending lf|crlf|cr"
+		return
+	}
+	for ending, name := range lineEndingNames {
+		if strings.EqualFold(args[0], name) {
+			format := e.format
+			format.LineEnding = ending
+			if e.format.Mixed {
+				// the line breaks the file had become plain newlines, and are all written as ending
+				if e.refuseEdit() {
+					return
+				}
+				format.Mixed = false
+				e.editFormat(format, func() { e.editAll(normalizeLineEndings(e.buffer.String())) })
+			}
+			e.format = format
+			e.message = "line endings set to " + name
+			return
+		}
+	}
+	e.message = "unknown line ending: " + args[0]
+}
+
+// encoding utf-8|utf-16le|utf-16be [bom|nobom] changes the encoding the file is saved with
+func (e *Editor) setEncoding(args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		e.message = "usage: encoding utf-8|utf-16le|utf-16be [bom|nobom]"
+		return
+	}
+	format := e.format
+	switch strings.ToUpper(args[0]) {
+	case "UTF-8", "UTF8":
+		format.Encoding = "UTF-8"
+		format.BOM = false
+	case "UTF-16LE", "UTF16LE":
+		format.Encoding = "UTF-16LE"
+		format.BOM = true
+	case "UTF-16BE", "UTF16BE":
+		format.Encoding = "UTF-16BE"
+		format.BOM = true
+	default:
+		e.message = "unknown encoding: " + args[0]
+		return
+	}
+	if len(args) == 2 {
+		switch strings.ToLower(args[1]) {
+		case "bom":
+			format.BOM = true
+		case "nobom":
+			format.BOM = false
+		default:
+			e.message = "expected bom or nobom, got " + args[1]
+			return
+		}
+	}
+	e.format = format
+	e.message = "encoding set to " + format.Encoding
+	if format.BOM {
+		e.message += " with BOM"
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Compressed files are opened by what their first bytes say they are, and a new
+// file by its extension. The buffer holds what is inside, and saving compresses
+// it again. Go can only read bzip2, so those files are opened read-only. A file
+// that only starts like compressed data is opened as it is.
+
+var (
+	magicGzip  = []byte{0x1f, 0x8b}
+	magicBzip2 = []byte("BZh")
+)
+
+// the compression data starts with, or "" if it doesn't look compressed
+func detectCompression(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, magicGzip):
+		return "gzip"
+	case bytes.HasPrefix(data, magicBzip2) && len(data) > 3 && data[3] >= '1' && data[3] <= '9':
+		return "bzip2"
+	}
+	return ""
+}
+
+// the compression a file with this name should get when it is written
+func compressionForName(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".gz":
+		return "gzip"
+	case ".bz2":
+		return "bzip2"
+	}
+	return ""
+}
+
+// whether the file at path starts like a compressed or encrypted file, without reading all of it
+func startsPacked(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	head := make([]byte, len(magicEncrypted))
+	n, _ := io.ReadFull(file, head)
+	return detectCompression(head[:n]) != "" || isEncrypted(head[:n])
+}
+
+// unpacking the data of a file if it is compressed, along with the compression it had
+func decompress(data []byte) ([]byte, string, error) {
+	kind := detectCompression(data)
+	var reader io.Reader
+	switch kind {
+	case "gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, kind, err
+		}
+		reader = gz
+	case "bzip2":
+		reader = bzip2.NewReader(bytes.NewReader(data))
+	default:
+		return data, "", nil
+	}
+	out, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, kind, errors.New("broken " + kind + " data: " + err.Error())
+	}
+	return out, kind, nil
+}
+
+// returned by unpack along with the data as it is, when the data starts like a
+// compressed file but isn't one
+type notCompressedError struct {
+	kind string
+	err  error
+}
+
+func (e *notCompressedError) Error() string {
+	return "starts like " + e.kind + " data but isn't (" + e.err.Error() + "), it is shown as it is"
+}
+
+// packing data up again before it is written
+func compress(data []byte, kind string) ([]byte, error) {
+	if kind == "" {
+		return data, nil
+	}
+	var out bytes.Buffer
+	w, err := compressWriter(&out, kind)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// a writer that compresses what is written to it into w, closing it finishes the data
+func compressWriter(w io.Writer, kind string) (io.WriteCloser, error) {
+	if kind == "gzip" {
+		return gzip.NewWriter(w), nil
+	}
+	return nil, errors.New(kind + " files can't be written, save it without the compression or as .gz")
+}
+
+// turning the bytes of a file on disk into what is in it, decrypting and then
+// decompressing them. It returns the compression and whether it was encrypted.
+func (e *Editor) unpack(name string, raw []byte) ([]byte, string, bool, error) {
+	data := raw
+	encrypted := isEncrypted(raw)
+	if encrypted {
+		var err error
+		data, err = e.unlock(name, raw)
+		if err != nil {
+			return nil, "", true, err
+		}
+	}
+	out, compression, err := decompress(data)
+	if err != nil {
+		// the magic bytes were a coincidence, or the file is damaged; either way its bytes can be shown
+		return data, "", encrypted, &notCompressedError{compression, err}
+	}
+	return out, compression, encrypted, nil
+}
+
+// the other way around from unpack, for saving
+func (e *Editor) pack(data []byte) ([]byte, error) {
+	data, err := compress(data, e.format.Compression)
+	if err != nil || !e.format.Encrypted {
+		return data, err
+	}
+	if e.passphrase == nil {
+		return nil, errors.New("the buffer has no passphrase to encrypt it with")
+	}
+	return encrypt(data, e.passphrase)
+}
+
+// setting how the open file is packed on disk
+func (e *Editor) setPacking(compression string, encrypted bool) {
+	e.format.Compression = compression
+	e.savedFormat.Compression = compression
+	e.format.Encrypted = encrypted
+	e.savedFormat.Encrypted = encrypted
+	if encrypted {
+		// the plaintext must not end up on disk
+		e.removeSwap()
+		e.noSwap = true
+	}
+}
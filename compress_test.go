@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileThatOnlyLooksCompressed(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	old := filename
+	t.Cleanup(func() { filename = old })
+	for name, data := range map[string]string{
+		"header.bin": "\x1f\x8b\x00\x01\x02\x03\x04",
+		"notes.txt":  "BZh9 is the start of this line\n",
+	} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		e := openTest(t, path)
+		if got := e.buffer.String(); got != data {
+			t.Errorf("%s opened as %q, want %q", name, got, data)
+		}
+		if e.format.Compression != "" {
+			t.Errorf("%s would be saved with %s compression", name, e.format.Compression)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypted files are kept on disk as a small header followed by the contents
+// sealed with AES-256-GCM, under a key made from a passphrase with scrypt. The
+// header is authenticated along with the contents, so a file that was changed
+// or a wrong passphrase both fail to open rather than giving garbage. The
+// plaintext only ever exists in memory: nothing is written to a swap file or a
+// backup for these buffers.
+
+var magicEncrypted = []byte("SLIKCRYPT1")
+
+const (
+	// scrypt costs, written into each file so they can be raised later
+	scryptLogN = 15
+	scryptR    = 8
+	scryptP    = 1
+
+	// the most a file may ask for, 128 * r * 2^logN bytes of memory is 2 GiB at most
+	maxScryptLogN = 20
+	maxScryptR    = 16
+	maxScryptP    = 4
+
+	saltSize  = 16
+	nonceSize = 12
+	// the magic, the three costs, the salt and the nonce
+	cryptHeaderSize = 10 + 3 + saltSize + nonceSize
+)
+
+var errPassphrase = errors.New("wrong passphrase, or the file was changed")
+
+// whether data starts like an encrypted file
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, magicEncrypted)
+}
+
+// making the AES-GCM cipher for a passphrase, salt and scrypt costs
+func newGCM(passphrase, salt []byte, logN, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, 1<<logN, r, p, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealing data with a passphrase, every call uses a new salt and nonce
+func encrypt(data, passphrase []byte) ([]byte, error) {
+	header := make([]byte, cryptHeaderSize)
+	copy(header, magicEncrypted)
+	header[10], header[11], header[12] = scryptLogN, scryptR, scryptP
+	if _, err := rand.Read(header[13:]); err != nil {
+		return nil, err
+	}
+	salt, nonce := header[13:13+saltSize], header[13+saltSize:]
+	gcm, err := newGCM(passphrase, salt, scryptLogN, scryptR, scryptP)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(header, nonce, data, header), nil
+}
+
+// opening data sealed by encrypt
+func decrypt(data, passphrase []byte) ([]byte, error) {
+	if len(data) < cryptHeaderSize || !isEncrypted(data) {
+		return nil, errors.New("not an encrypted file")
+	}
+	header := data[:cryptHeaderSize]
+	logN, r, p := int(header[10]), int(header[11]), int(header[12])
+	// the costs come from the file, so a damaged or hostile one mustn't make scrypt
+	// divide by zero or take more memory than there is
+	if logN < 10 || logN > maxScryptLogN || r < 1 || r > maxScryptR || p < 1 || p > maxScryptP {
+		return nil, errors.New("the encryption header is damaged")
+	}
+	salt, nonce := header[13:13+saltSize], header[13+saltSize:]
+	gcm, err := newGCM(passphrase, salt, logN, r, p)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, nonce, data[cryptHeaderSize:], header)
+	if err != nil {
+		return nil, errPassphrase
+	}
+	return plain, nil
+}
+
+// decrypting the data of a file, trying the passphrase the buffer already has before asking for one
+func (e *Editor) unlock(name string, data []byte) ([]byte, error) {
+	if e.passphrase != nil {
+		if plain, err := decrypt(data, e.passphrase); err == nil {
+			return plain, nil
+		}
+	}
+	label := "passphrase for " + name + ": "
+	for {
+		passphrase, ok := e.PromptPassword(label)
+		if !ok {
+			return nil, errors.New("no passphrase was given")
+		}
+		plain, err := decrypt(data, []byte(passphrase))
+		if err == errPassphrase {
+			label = "wrong passphrase for " + name + ", try again: "
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		e.passphrase = []byte(passphrase)
+		return plain, nil
+	}
+}
+
+// asking for a new passphrase twice, it returns false if they didn't match or Esc was pressed
+func (e *Editor) newPassphrase() bool {
+	first, ok := e.PromptPassword("new passphrase: ")
+	if !ok || first == "" {
+		e.message = "no passphrase was set"
+		return false
+	}
+	second, ok := e.PromptPassword("the same passphrase again: ")
+	if !ok || second != first {
+		e.message = "the passphrases didn't match"
+		return false
+	}
+	e.passphrase = []byte(first)
+	return true
+}
+
+// asking for the passphrase before an encrypted buffer is saved, Enter keeps the one it has
+func (e *Editor) confirmPassphrase() bool {
+	if e.passphrase == nil {
+		return e.newPassphrase()
+	}
+	passphrase, ok := e.PromptPassword("passphrase to save with (Enter keeps the current one): ")
+	if !ok {
+		return false
+	}
+	if passphrase == "" {
+		return true
+	}
+	again, ok := e.PromptPassword("the same passphrase again: ")
+	if !ok || again != passphrase {
+		e.message = "the passphrases didn't match, nothing was saved"
+		return false
+	}
+	e.passphrase = []byte(passphrase)
+	return true
+}
+
+// marking the buffer as encrypted, it is written encrypted from the next save on
+func (e *Editor) encryptBuffer() {
+	if e.largeFile {
+		e.message = "large files can't be encrypted"
+		return
+	}
+	if !e.newPassphrase() {
+		return
+	}
+	e.format.Encrypted = true
+	// the swap file holds the plain text, so it goes and nothing more is journaled
+	e.removeSwap()
+	e.noSwap = true
+	// nor into the undo file, and the history kept from before goes
+	e.writeUndo()
+	e.message = "the buffer will be encrypted when it is saved"
+}
+
+// marking the buffer to be saved as plain text again
+func (e *Editor) decryptBuffer() {
+	if !e.format.Encrypted {
+		e.message = "the buffer isn't encrypted"
+		return
+	}
+	e.format.Encrypted = false
+	e.passphrase = nil
+	e.message = "the buffer will be saved without encryption"
+}
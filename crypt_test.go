@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncryptRoundTrip(t *testing.T) {
+	sealed, err := encrypt([]byte("secret text"), []byte("pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := decrypt(sealed, []byte("pass"))
+	if err != nil || !bytes.Equal(plain, []byte("secret text")) {
+		t.Fatalf("decrypted to %q, %v", plain, err)
+	}
+	if _, err := decrypt(sealed, []byte("wrong")); err != errPassphrase {
+		t.Errorf("a wrong passphrase gave %v", err)
+	}
+}
+
+func TestDecryptRejectsBadCosts(t *testing.T) {
+	sealed, err := encrypt([]byte("secret text"), []byte("pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, costs := range [][3]byte{
+		{15, 8, 0},   // scrypt would divide by zero
+		{15, 0, 1},   // and here too
+		{30, 8, 1},   // a TiB of memory
+		{20, 255, 1}, // far too much as well
+		{9, 8, 1},
+	} {
+		data := bytes.Clone(sealed)
+		data[10], data[11], data[12] = costs[0], costs[1], costs[2]
+		if _, err := decrypt(data, []byte("pass")); err == nil || err == errPassphrase {
+			t.Errorf("costs %v gave %v, want a damaged header", costs, err)
+		}
+	}
+}
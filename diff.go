@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the most lines on either side that are compared line by line, beyond that a
+// changed block is shown as removed and added as a whole
+const maxDiffCells = 4000000
+
+// a line of a diff, kind is ' ', '-' or '+'
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// comparing two texts line by line and returning the result as a unified diff
+func unifiedDiff(oldName, newName, oldText, newText string) []string {
+	lines := diffLines(strings.Split(oldText, "\n"), strings.Split(newText, "\n"))
+	out := []string{"--- " + oldName, "+++ " + newName}
+	const context = 3
+	for i := 0; i < len(lines); {
+		if lines[i].kind == ' ' {
+			i++
+			continue
+		}
+		// a hunk starts a few lines before the change and runs until the lines are the same for a while
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(lines) {
+			if lines[end].kind != ' ' {
+				end++
+				continue
+			}
+			same := 0
+			for end+same < len(lines) && lines[end+same].kind == ' ' && same <= 2*context {
+				same++
+			}
+			if end+same == len(lines) || same > 2*context {
+				end += min(same, context)
+				break
+			}
+			end += same
+		}
+		oldStart, newStart := lineNumbers(lines[:start])
+		oldCount, newCount := lineNumbers(lines[start:end])
+		out = append(out, fmt.Sprintf("@@ -%d,%d +%d,%d @@", oldStart+1, oldCount, newStart+1, newCount))
+		for _, line := range lines[start:end] {
+			out = append(out, string(line.kind)+line.text)
+		}
+		i = end
+	}
+	return out
+}
+
+// how many lines of each side are in part of a diff
+func lineNumbers(lines []diffLine) (int, int) {
+	oldCount, newCount := 0, 0
+	for _, line := range lines {
+		if line.kind != '+' {
+			oldCount++
+		}
+		if line.kind != '-' {
+			newCount++
+		}
+	}
+	return oldCount, newCount
+}
+
+// finding the lines that stay the same between a and b with a longest common subsequence
+func diffLines(a, b []string) []diffLine {
+	// lines at the start and the end that are the same don't need comparing
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	var out []diffLine
+	for _, line := range a[:prefix] {
+		out = append(out, diffLine{' ', line})
+	}
+	oldMiddle, newMiddle := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(oldMiddle)*len(newMiddle) > maxDiffCells {
+		for _, line := range oldMiddle {
+			out = append(out, diffLine{'-', line})
+		}
+		for _, line := range newMiddle {
+			out = append(out, diffLine{'+', line})
+		}
+	} else {
+		out = append(out, lcsDiff(oldMiddle, newMiddle)...)
+	}
+	for _, line := range a[len(a)-suffix:] {
+		out = append(out, diffLine{' ', line})
+	}
+	return out
+}
+
+func lcsDiff(a, b []string) []diffLine {
+	// lengths[i][j] is the length of the common subsequence of a[i:] and b[j:]
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+	var out []diffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, diffLine{' ', a[i]})
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			out = append(out, diffLine{'-', a[i]})
+			i++
+		default:
+			out = append(out, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, diffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		out = append(out, diffLine{'+', b[j]})
+	}
+	return out
+}
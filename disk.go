@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha256"
+	"os"
+	"time"
+)
+
+// what the open file looked like on disk when it was last read or saved. The
+// size and modification time are cheap to check after every key press, the hash
+// tells a real change apart from a file that was only touched.
+type diskState struct {
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+}
+
+func newDiskState(info os.FileInfo, data []byte) diskState {
+	return diskState{modTime: info.ModTime(), size: info.Size(), hash: sha256.Sum256(data)}
+}
+
+// remembering what the file on disk looks like after it was read or written
+func (e *Editor) recordDisk(path string, data []byte) {
+	info, err := os.Stat(path)
+	if err != nil {
+		e.disk = diskState{}
+		return
+	}
+	e.disk = newDiskState(info, data)
+}
+
+// checking whether something else changed the open file, it returns the new contents if it did
+func (e *Editor) diskChanged() (bool, []byte) {
+	if filename == "" || e.disk.modTime.IsZero() {
+		return false, nil
+	}
+	info, err := os.Stat(filename)
+	if err != nil || info.ModTime().Equal(e.disk.modTime) && info.Size() == e.disk.size {
+		return false, nil
+	}
+	if e.largeFile {
+		// large files are not hashed, any change to the size or time counts
+		return true, nil
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return false, nil
+	}
+	state := newDiskState(info, data)
+	if state.hash == e.disk.hash {
+		// only the time changed, there is nothing to reload
+		e.disk = state
+		return false, nil
+	}
+	return true, data
+}
+
+// reloading the open file if it was changed on disk, or asking first if the buffer has unsaved changes
+func (e *Editor) checkDisk() {
+	changed, data := e.diskChanged()
+	if !changed {
+		return
+	}
+	if !e.Modified() {
+		if err := e.reload(); err != nil {
+			e.message = err.Error()
+			return
+		}
+		e.message = filename + " changed on disk and was reloaded"
+		return
+	}
+	question, answers := filename+" changed on disk: (r)eload it (k)eep your changes (v)iew diff", "rkv"
+	if data == nil || e.format.Encrypted {
+		question, answers = filename+" changed on disk: (r)eload it (k)eep your changes", "rk"
+	}
+	for {
+		switch e.Ask(question, answers) {
+		case 'r':
+			if err := e.reload(); err != nil {
+				e.message = err.Error()
+				return
+			}
+			e.message = "reloaded " + filename
+			return
+		case 'v':
+			// data stays as it is on disk, keeping the changes hashes it
+			plain, _, _ := decompress(data)
+			text, _ := decodeFile(plain)
+			e.ShowText("changes on disk", unifiedDiff("buffer", filename, e.buffer.String(), text))
+		default:
+			// the buffer wins, the next save overwrites the file without asking again
+			info, err := os.Stat(filename)
+			if err == nil {
+				e.disk = newDiskState(info, data)
+				if e.largeFile {
+					e.disk.hash = [sha256.Size]byte{}
+				}
+			}
+			e.message = "kept your changes, saving will overwrite " + filename
+			return
+		}
+	}
+}
+
+// reading the open file again, throwing away the buffer and its history
+func (e *Editor) reload() error {
+	line := e.cursorY + e.offsetY
+	if err := e.ReadFile(filename); err != nil {
+		return err
+	}
+	e.resetUndo()
+	if !e.buffer.HasLine(line) {
+		line = e.buffer.LineCount() - 1
+	}
+	e.setCursor(line, 0)
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// the way a file is stored on disk, the buffer itself always holds UTF-8 with \n line endings
+type FileFormat struct {
+	LineEnding string // "\n", "\r\n" or "\r"
+	Encoding   string // "UTF-8", "UTF-16LE" or "UTF-16BE"
+	BOM        bool
+	// "gzip" or "bzip2" for a compressed file, see compress.go
+	Compression string `json:",omitempty"`
+	// saved encrypted with a passphrase, see crypt.go
+	Encrypted bool `json:",omitempty"`
+	// the file has more than one kind of line ending, they are kept in the buffer
+	// as they are and LineEnding is "\n" so they are written back the same
+	Mixed bool `json:",omitempty"`
+}
+
+var defaultFormat = FileFormat{LineEnding: "\n", Encoding: "UTF-8"}
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// names for the line endings, used by the stat bar and the lineending command
+var lineEndingNames = map[string]string{
+	"\n":   "LF",
+	"\r\n": "CRLF",
+	"\r":   "CR",
+}
+
+func (f FileFormat) String() string {
+	text := lineEndingNames[f.LineEnding] + " " + f.Encoding
+	if f.Mixed {
+		text = "mixed " + f.Encoding
+	}
+	if f.BOM {
+		text += " BOM"
+	}
+	if f.Compression != "" {
+		text += " " + f.Compression
+	}
+	if f.Encrypted {
+		text += " encrypted"
+	}
+	return text
+}
+
+// turning the bytes of a file into the text for the buffer and the format it was in
+func decodeFile(data []byte) (string, FileFormat) {
+	format := defaultFormat
+	var text string
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		format.BOM = true
+		text = string(data[len(bomUTF8):])
+	case bytes.HasPrefix(data, bomUTF16LE):
+		format.BOM = true
+		format.Encoding = "UTF-16LE"
+		text = decodeUTF16(data[len(bomUTF16LE):], binary.LittleEndian)
+	case bytes.HasPrefix(data, bomUTF16BE):
+		format.BOM = true
+		format.Encoding = "UTF-16BE"
+		text = decodeUTF16(data[len(bomUTF16BE):], binary.BigEndian)
+	default:
+		format.Encoding = guessUTF16(data)
+		switch format.Encoding {
+		case "UTF-16LE":
+			text = decodeUTF16(data, binary.LittleEndian)
+		case "UTF-16BE":
+			text = decodeUTF16(data, binary.BigEndian)
+		default:
+			text = string(data)
+		}
+	}
+
+	format.LineEnding = detectLineEnding(text)
+	switch {
+	case mixedLineEndings(text):
+		// turning them all into one kind would change the lines that don't use the
+		// most common one, so the file is kept as it is until the lineending command
+		format.LineEnding = "\n"
+		format.Mixed = true
+	case format.LineEnding != "\n":
+		text = normalizeLineEndings(text)
+	}
+	return text, format
+}
+
+// turning the text of the buffer back into bytes in the given format
+func encodeFile(text string, format FileFormat) []byte {
+	if format.LineEnding != "\n" {
+		text = strings.ReplaceAll(text, "\n", format.LineEnding)
+	}
+	var data []byte
+	switch format.Encoding {
+	case "UTF-16LE":
+		if format.BOM {
+			data = append(data, bomUTF16LE...)
+		}
+		data = append(data, encodeUTF16(text, binary.LittleEndian)...)
+	case "UTF-16BE":
+		if format.BOM {
+			data = append(data, bomUTF16BE...)
+		}
+		data = append(data, encodeUTF16(text, binary.BigEndian)...)
+	default:
+		if format.BOM {
+			data = append(data, bomUTF8...)
+		}
+		data = append(data, text...)
+	}
+	return data
+}
+
+// the most common line ending in text, files without any line breaks get LF
+func detectLineEnding(text string) string {
+	crlf := strings.Count(text, "\r\n")
+	cr := strings.Count(text, "\r") - crlf
+	lf := strings.Count(text, "\n") - crlf
+	switch {
+	case crlf > 0 && crlf >= lf && crlf >= cr:
+		return "\r\n"
+	case cr > 0 && cr > lf:
+		return "\r"
+	}
+	return "\n"
+}
+
+// whether text has more than one kind of line ending
+func mixedLineEndings(text string) bool {
+	crlf := strings.Count(text, "\r\n")
+	kinds := 0
+	for _, n := range []int{crlf, strings.Count(text, "\r") - crlf, strings.Count(text, "\n") - crlf} {
+		if n > 0 {
+			kinds++
+		}
+	}
+	return kinds > 1
+}
+
+// UTF-16 without a BOM is recognised by the zero bytes in mostly ASCII text
+func guessUTF16(data []byte) string {
+	if len(data) < 2 || len(data)%2 != 0 || utf8.Valid(data) && bytes.IndexByte(data, 0) == -1 {
+		return "UTF-8"
+	}
+	evenZeros, oddZeros := 0, 0
+	for i := 0; i+1 < len(data); i += 2 {
+		if data[i] == 0 {
+			evenZeros++
+		}
+		if data[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	pairs := len(data) / 2
+	switch {
+	case oddZeros > pairs/2 && evenZeros == 0:
+		return "UTF-16LE"
+	case evenZeros > pairs/2 && oddZeros == 0:
+		return "UTF-16BE"
+	}
+	return "UTF-8"
+}
+
+func decodeUTF16(data []byte, order binary.ByteOrder) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
+
+func encodeUTF16(text string, order binary.ByteOrder) []byte {
+	units := utf16.Encode([]rune(text))
+	data := make([]byte, len(units)*2)
+	for i, unit := range units {
+		order.PutUint16(data[i*2:], unit)
+	}
+	return data
+}
@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestLineEndingsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		text  string
+		mixed bool
+	}{
+		{name: "LF", data: "a\nb\n", text: "a\nb\n"},
+		{name: "CRLF", data: "a\r\nb\r\n", text: "a\nb\n"},
+		{name: "CR", data: "a\rb\r", text: "a\nb\n"},
+		{name: "no line breaks", data: "a", text: "a"},
+		{name: "mostly CR with a CRLF", data: "a\rb\rc\r\nd\re", text: "a\rb\rc\r\nd\re", mixed: true},
+		{name: "mostly CRLF with an LF", data: "a\r\nb\r\nc\nd\r\n", text: "a\r\nb\r\nc\nd\r\n", mixed: true},
+		{name: "UTF-16 CRLF", data: "\xff\xfea\x00\r\x00\n\x00", text: "a\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			text, format := decodeFile([]byte(test.data))
+			if text != test.text {
+				t.Errorf("decoded to %q, want %q", text, test.text)
+			}
+			if format.Mixed != test.mixed {
+				t.Errorf("mixed is %v, want %v", format.Mixed, test.mixed)
+			}
+			if got := string(encodeFile(text, format)); got != test.data {
+				t.Errorf("written back as %q, want %q", got, test.data)
+			}
+		})
+	}
+}
+
+func TestLineEndingCommandEndsMixed(t *testing.T) {
+	text, format := decodeFile([]byte("a\r\nb\nc\r\n"))
+	e := testEditor(text)
+	e.format, e.savedFormat = format, format
+	e.RunCommand("lineending crlf")
+	if e.format.Mixed || e.format.LineEnding != "\r\n" {
+		t.Fatalf("the format is %+v after the lineending command", e.format)
+	}
+	if got := string(encodeFile(e.buffer.String(), e.format)); got != "a\r\nb\r\nc\r\n" {
+		t.Errorf("written as %q", got)
+	}
+	e.Undo()
+	if got := e.buffer.String(); got != text {
+		t.Errorf("undo left %q, want %q", got, text)
+	}
+	if got := string(encodeFile(e.buffer.String(), e.format)); got != "a\r\nb\nc\r\n" {
+		t.Errorf("after undo it is written as %q", got)
+	}
+	if e.Modified() {
+		t.Error("undoing the only change left the buffer modified")
+	}
+	e.Redo()
+	if got := string(encodeFile(e.buffer.String(), e.format)); got != "a\r\nb\r\nc\r\n" {
+		t.Errorf("after redo it is written as %q", got)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+// termbox only has a blocking PollEvent, so a goroutine waits on it and hands the
+// events over a channel. That way the main loop can stop waiting for keys now and
+// then to do things on a timer, like autosaving. Everything that reads keys goes
+// through here so no event is read by two callers.
+
+// how often the main loop wakes up when no keys are pressed
+const tickInterval = time.Second
+
+var events = make(chan termbox.Event)
+
+// starting to read events from the terminal, it has to be called after termbox.Init
+func startEvents() {
+	go func() {
+		for {
+			events <- termbox.PollEvent()
+		}
+	}()
+}
+
+// waiting for the next event from the terminal
+func pollEvent() termbox.Event {
+	return <-events
+}
+
+// waiting for the next event for at most timeout, an event of type EventNone means the time ran out
+func waitEvent(timeout time.Duration) termbox.Event {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case ev := <-events:
+		return ev
+	case <-timer.C:
+		return termbox.Event{Type: termbox.EventNone}
+	}
+}
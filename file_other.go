@@ -0,0 +1,31 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+)
+
+// files have no unix owner here, a renamed file keeps the one who wrote it
+func keepOwner(name string, info os.FileInfo) error {
+	return nil
+}
+
+// there is no cheap way to ask about another process here, so it is treated as gone
+func processAlive(pid int) bool {
+	return false
+}
+
+// there is no umask here, new files get the permissions asked for
+func umask() os.FileMode {
+	return 0
+}
+
+// directories cannot be synced here, the rename is as durable as the system makes it
+func syncDir(dir string) {}
+
+// whether the file at path may be written, going by its read-only attribute
+func writable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().Perm()&0200 != 0
+}
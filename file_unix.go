@@ -0,0 +1,46 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// giving name the same owner and group as the file described by info
+func keepOwner(name string, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return os.Chown(name, int(stat.Uid), int(stat.Gid))
+}
+
+// whether a process with the given id is running
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// the permission bits the umask takes away from new files. The umask can only be
+// read by setting it, so it is put straight back.
+func umask() os.FileMode {
+	mask := syscall.Umask(0)
+	syscall.Umask(mask)
+	return os.FileMode(mask)
+}
+
+// syncing a directory so a rename inside it survives a crash
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// whether the current user may write to the file at path
+func writable(path string) bool {
+	return syscall.Access(path, 0x2) == nil // W_OK
+}
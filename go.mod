@@ -3,12 +3,16 @@ module nano
 go 1.21.6
 
 require (
-	github.com/mattn/go-runewidth v0.0.15 // indirect
-	github.com/nsf/termbox-go v1.1.1 // indirect
-	github.com/rivo/uniseg v0.2.0 // indirect
-	golang.design/x/clipboard v0.7.0 // indirect
+	github.com/mattn/go-runewidth v0.0.15
+	github.com/nsf/termbox-go v1.1.1
+	github.com/rivo/uniseg v0.2.0
+	golang.design/x/clipboard v0.7.0
+	golang.org/x/crypto v0.8.0
+)
+
+require (
 	golang.org/x/exp v0.0.0-20190731235908-ec7cb31e5a56 // indirect
 	golang.org/x/image v0.6.0 // indirect
 	golang.org/x/mobile v0.0.0-20230301163155-e0f57694e12c // indirect
-	golang.org/x/sys v0.5.0 // indirect
+	golang.org/x/sys v0.7.0 // indirect
 )
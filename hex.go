@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nsf/termbox-go"
+)
+
+// Binary files are shown as hex, 16 bytes to a row with the offset on the left
+// and the bytes as ASCII on the right. The buffer holds the bytes of the file as
+// they are, so saving writes back exactly what was read plus the edits. Every
+// edit is recorded like any other, so undo works on bytes just like it does on text.
+
+// how many bytes are looked at to decide whether a file is binary
+const binarySample = 8000
+
+// how many bytes are shown on a row
+const hexRow = 16
+
+// where the cursor is in the hex view and how typing behaves
+type hexView struct {
+	// the byte the cursor is on, the length of the buffer means after the last byte
+	cursor int
+	// the first row on the screen
+	top int
+	// typing goes into the low half of the byte under the cursor next
+	low bool
+	// typing inserts bytes instead of writing over them
+	insert bool
+	// typing goes to the ASCII column instead of the hex one
+	ascii bool
+}
+
+// guessing whether data is binary: text has no NUL bytes (unless it is UTF-16)
+// and not many bytes that are neither UTF-8 nor printable
+func isBinary(data []byte) bool {
+	if bytes.HasPrefix(data, bomUTF16LE) || bytes.HasPrefix(data, bomUTF16BE) {
+		return false
+	}
+	sample := data[:min(len(data), binarySample)]
+	if guessUTF16(sample) != "UTF-8" {
+		return false
+	}
+	if bytes.IndexByte(sample, 0) != -1 {
+		return true
+	}
+	odd := 0
+	for i := 0; i < len(sample); {
+		r, size := utf8.DecodeRune(sample[i:])
+		switch {
+		case r == utf8.RuneError && size == 1 && len(sample)-i >= utf8.UTFMax:
+			// a character cut in half at the end of the sample doesn't count
+			odd++
+		case r < 0x20 && r != '\n' && r != '\r' && r != '\t' && r != '\f' && r != 0x1b:
+			odd++
+		}
+		i += size
+	}
+	return odd*10 > len(sample)
+}
+
+// showing the bytes of a file in the hex view, the history starts over
+func (e *Editor) openHex(data []byte) {
+	e.buffer = NewPieceTable(data)
+	e.unmap()
+	e.hex = &hexView{}
+	e.format = defaultFormat
+	e.savedFormat = defaultFormat
+	e.largeFile = false
+	e.message = "binary file, showing it as hex (the hex command switches back to text)"
+}
+
+// switching the open file between the hex view and text, it is read again from disk
+func (e *Editor) toggleHex() {
+	switch {
+	case filename == "":
+		e.message = "the buffer has to be saved to a file first"
+		return
+	case e.largeFile:
+		e.message = "large files can't switch between hex and text"
+		return
+	case e.Modified():
+		e.message = "save the changes first, the file is read again to switch"
+		return
+	}
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		e.message = readError(filename, err).Error()
+		return
+	}
+	data, compression, encrypted, err := e.unpack(filename, raw)
+	var notCompressed *notCompressedError
+	if err != nil && !errors.As(err, &notCompressed) {
+		e.message = readError(filename, err).Error()
+		return
+	}
+	e.recordDisk(filename, raw)
+	if e.hex == nil {
+		e.openHex(data)
+		e.message = "showing " + filename + " as hex"
+	} else {
+		e.openText(data)
+		e.message = "showing " + filename + " as text"
+	}
+	e.setPacking(compression, encrypted)
+	e.resetUndo()
+	e.setCursor(0, 0)
+}
+
+// handling a key in the hex view, it returns false for keys that work the same as in text
+func (e *Editor) hexKey(ev termbox.Event) bool {
+	h := e.hex
+	rows := max(e.height, 1)
+	switch ev.Key {
+	case termbox.KeyEsc, termbox.KeyCtrlE, termbox.KeyCtrlS, termbox.KeyCtrlO:
+		return false
+	case termbox.KeyArrowLeft:
+		e.hexMove(h.cursor - 1)
+	case termbox.KeyArrowRight:
+		e.hexMove(h.cursor + 1)
+	case termbox.KeyArrowUp:
+		e.hexMove(h.cursor - hexRow)
+	case termbox.KeyArrowDown:
+		e.hexMove(h.cursor + hexRow)
+	case termbox.KeyPgup:
+		e.hexMove(h.cursor - hexRow*rows)
+	case termbox.KeyPgdn:
+		e.hexMove(h.cursor + hexRow*rows)
+	case termbox.KeyHome:
+		e.hexMove(h.cursor - h.cursor%hexRow)
+	case termbox.KeyEnd:
+		e.hexMove(h.cursor - h.cursor%hexRow + hexRow - 1)
+	case termbox.KeyTab:
+		h.ascii = !h.ascii
+		h.low = false
+	case termbox.KeyInsert:
+		h.insert = !h.insert
+	case termbox.KeyCtrlZ:
+		e.Undo()
+	case termbox.KeyCtrlY:
+		e.Redo()
+	case termbox.KeyCtrlF:
+		if text, ok := e.Prompt("find bytes (hex, or \"text\"): "); ok {
+			e.hexFind(text)
+		}
+	case termbox.KeyCtrlG:
+		if text, ok := e.Prompt("go to offset: "); ok {
+			e.hexGoto(text)
+		}
+	case termbox.KeyBackspace, termbox.KeyBackspace2:
+		if h.cursor > 0 && !e.refuseEdit() {
+			e.edit(h.cursor-1, 1, "")
+			e.hexMove(h.cursor - 1)
+		}
+	case termbox.KeyDelete:
+		if h.cursor < e.buffer.Len() && !e.refuseEdit() {
+			e.edit(h.cursor, 1, "")
+			h.low = false
+		}
+	case termbox.KeySpace:
+		if h.ascii {
+			e.hexType(" ")
+		}
+	default:
+		if ev.Ch == 0 {
+			break
+		}
+		if h.ascii {
+			e.hexType(string(ev.Ch))
+			break
+		}
+		digit, err := strconv.ParseUint(string(ev.Ch), 16, 8)
+		if err == nil {
+			e.hexNibble(byte(digit))
+		}
+	}
+	return true
+}
+
+// moving the cursor to a byte, staying inside the buffer
+func (e *Editor) hexMove(offset int) {
+	e.hex.cursor = max(0, min(offset, e.buffer.Len()))
+	e.hex.low = false
+}
+
+// writing over or inserting bytes typed in the ASCII column
+func (e *Editor) hexType(text string) {
+	if e.refuseEdit() {
+		return
+	}
+	h := e.hex
+	length := 0
+	if !h.insert {
+		length = min(len(text), e.buffer.Len()-h.cursor)
+	}
+	e.edit(h.cursor, length, text)
+	e.hexMove(h.cursor + len(text))
+}
+
+// typing one hex digit into the byte under the cursor, the high half first
+func (e *Editor) hexNibble(digit byte) {
+	if e.refuseEdit() {
+		return
+	}
+	h := e.hex
+	if !h.low && (h.insert || h.cursor == e.buffer.Len()) {
+		// a new byte, the low half stays 0 until it is typed
+		e.edit(h.cursor, 0, string([]byte{digit << 4}))
+		h.low = true
+		return
+	}
+	old := e.buffer.Slice(h.cursor, h.cursor+1)[0]
+	b := old&0x0f | digit<<4
+	if h.low {
+		b = old&0xf0 | digit
+	}
+	e.edit(h.cursor, 1, string([]byte{b}))
+	if h.low {
+		e.hexMove(h.cursor + 1)
+	} else {
+		h.low = true
+	}
+}
+
+// turning what was typed at the find prompt into bytes, either hex digits or a quoted text
+func parseBytes(text string) ([]byte, error) {
+	text = strings.TrimSpace(text)
+	if len(text) >= 2 && text[0] == '"' && text[len(text)-1] == '"' {
+		return []byte(text[1 : len(text)-1]), nil
+	}
+	pattern, err := hex.DecodeString(strings.Join(strings.Fields(text), ""))
+	if err != nil {
+		return nil, errors.New("expected hex bytes like de ad be ef, or text in quotes")
+	}
+	return pattern, nil
+}
+
+// moving the cursor to the next place a byte pattern is found, going back to the start after the end
+func (e *Editor) hexFind(text string) {
+	if text == "" {
+		text = e.lastSearch
+	}
+	pattern, err := parseBytes(text)
+	if err != nil || len(pattern) == 0 {
+		if err != nil {
+			e.message = err.Error()
+		}
+		return
+	}
+	e.lastSearch = text
+	found := e.buffer.Index(string(pattern), e.hex.cursor+1)
+	if found == -1 {
+		found = e.buffer.Index(string(pattern), 0)
+		if found != -1 && found <= e.hex.cursor {
+			e.message = "search wrapped around"
+		}
+	}
+	if found == -1 {
+		e.message = "not found: " + text
+		return
+	}
+	e.hexMove(found)
+}
+
+// moving the cursor to an offset, written in decimal or with 0x for hex
+func (e *Editor) hexGoto(text string) {
+	offset, err := strconv.ParseInt(strings.TrimSpace(text), 0, 64)
+	if err != nil || offset < 0 || offset > int64(e.buffer.Len()) {
+		e.message = "there is no offset " + text
+		return
+	}
+	e.hexMove(int(offset))
+}
+
+// the stat bar in the hex view
+func (e *Editor) hexStatBar() string {
+	h := e.hex
+	mode := "OVR"
+	if h.insert {
+		mode = "INS"
+	}
+	column := "hex"
+	if h.ascii {
+		column = "ascii"
+	}
+	bar := fmt.Sprintf("offset: 0x%x (%d) of %d | %s %s | ", h.cursor, h.cursor, e.buffer.Len(), column, mode)
+	if e.format.Compression != "" {
+		bar += e.format.Compression + " | "
+	}
+	bar += filename
+	if e.Modified() {
+		bar += " [+]"
+	}
+	if e.readOnly {
+		bar += " [RO]"
+	}
+	return bar
+}
+
+// drawing the rows of the hex view and putting the cursor on the byte it is at
+func (e *Editor) renderHex() {
+	h := e.hex
+	h.cursor = min(h.cursor, e.buffer.Len())
+	rows := max(e.height, 1)
+	// keep the cursor's row on the screen
+	row := h.cursor / hexRow
+	if row < h.top {
+		h.top = row
+	} else if row >= h.top+rows {
+		h.top = row - rows + 1
+	}
+	data := e.buffer.Slice(h.top*hexRow, (h.top+rows)*hexRow)
+	hexX := func(i int) int { return 10 + i*3 + i/8 }
+	asciiX := hexX(hexRow) + 1
+	for i := 0; i < rows && i*hexRow <= len(data); i++ {
+		offset := (h.top + i) * hexRow
+		drawString(0, i, e.width, fmt.Sprintf("%08x", offset), termbox.ColorYellow, termbox.ColorDefault)
+		for j := 0; j < hexRow && i*hexRow+j < len(data); j++ {
+			b := data[i*hexRow+j]
+			color := termbox.ColorDefault
+			if b == 0 {
+				color = termbox.ColorBlue
+			}
+			drawString(hexX(j), i, e.width, fmt.Sprintf("%02x", b), color, termbox.ColorDefault)
+			r := '.'
+			if b >= 0x20 && b < 0x7f {
+				r = rune(b)
+			}
+			termbox.SetCell(asciiX+j, i, r, color, termbox.ColorDefault)
+		}
+	}
+	e.drawStatBar()
+	col := h.cursor % hexRow
+	if h.ascii {
+		termbox.SetCursor(asciiX+col, row-h.top)
+	} else {
+		x := hexX(col)
+		if h.low {
+			x++
+		}
+		termbox.SetCursor(x, row-h.top)
+	}
+}
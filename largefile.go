@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strconv"
+)
+
+// Files at least settings.LargeFileSize bytes long are opened in large file mode.
+// The file is mapped into memory and used as the text of the buffer as it is,
+// without decoding it or converting line endings, and lines are only found when
+// the view or a search gets to them. Highlighting and the swap file are off, and
+// saving streams the text to the new file instead of building it in memory.
+//
+// The mapping is shared with the file, so when another program cuts the file
+// short, reading past its new end faults. The mapped file is checked after every
+// event and read again if it shrank, and a fault between that check and the next
+// read becomes a panic, which main recovers from like any other crash. Saving
+// moves the buffer over to the new file and lets go of the old mapping, so the
+// old file's space is freed and Windows lets the file be replaced.
+
+// whether a file is big enough to be opened in large file mode
+func isLargeFile(info os.FileInfo) bool {
+	return settings.LargeFileSize > 0 && info.Size() >= settings.LargeFileSize
+}
+
+// opening a file in large file mode
+func (e *Editor) readLargeFile(name string, info os.FileInfo) error {
+	file, data, err := mapPath(name)
+	if err != nil {
+		return err
+	}
+	e.unmap()
+	e.mapped, e.mapping = file, data
+	e.buffer = NewPieceTable(data)
+	e.largeFile = true
+	e.hex = nil
+	if isBinary(data) {
+		e.hex = &hexView{}
+	}
+	e.noSwap = true
+	e.format = defaultFormat
+	e.savedFormat = defaultFormat
+	// hashing gigabytes after every change on disk is too slow, the size and time have to do
+	e.disk = diskState{modTime: info.ModTime(), size: info.Size()}
+	e.message = "large file: highlighting and the swap file are off"
+	return nil
+}
+
+// saving in large file mode. The buffer may still be reading from the mapped file,
+// so the file is always replaced by a new one and never overwritten in place. A
+// name that asks for compression gets the text compressed on its way to the file.
+func (e *Editor) saveLargeFile() error {
+	if e.format.Encrypted {
+		return errors.New("large files can't be encrypted")
+	}
+	write := func(w io.Writer) error {
+		if e.format.Compression == "" {
+			_, err := e.buffer.WriteTo(w)
+			return err
+		}
+		packed, err := compressWriter(w, e.format.Compression)
+		if err != nil {
+			return err
+		}
+		if _, err := e.buffer.WriteTo(packed); err != nil {
+			return err
+		}
+		return packed.Close()
+	}
+	err := writeFileFrom(filename, 0644, write, func(tmp string) error {
+		if e.format.Compression != "" {
+			// the new file doesn't hold the text as it is, the buffer can't read from it
+			return nil
+		}
+		return e.remap(tmp)
+	})
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(filename); err == nil {
+		e.disk = diskState{modTime: info.ModTime(), size: info.Size()}
+	}
+	return nil
+}
+
+// moving the cursor to the start of a line, counted from 1
+func (e *Editor) GotoLine(line int) {
+	if line < 1 || !e.buffer.HasLine(line-1) {
+		e.message = "there is no line " + strconv.Itoa(line)
+		return
+	}
+	e.setCursor(line-1, 0)
+}
+
+// moving the cursor to the next place text is found, going back to the start after the end
+func (e *Editor) Find(text string) {
+	if text == "" {
+		text = e.lastSearch
+	}
+	if text == "" {
+		return
+	}
+	e.lastSearch = text
+	cursor := e.buffer.Offset(e.cursorY+e.offsetY, e.cursorX+e.offsetX)
+	found := e.buffer.Index(text, cursor+1)
+	if found == -1 {
+		found = e.buffer.Index(text, 0)
+		if found != -1 && found <= cursor {
+			e.message = "search wrapped around"
+		}
+	}
+	if found == -1 {
+		e.message = "not found: " + text
+		return
+	}
+	e.setCursor(e.buffer.Position(found))
+}
+
+// opening and mapping the file at name. The file is kept open to see its size
+// even after it was renamed or replaced.
+func mapPath(name string) (*os.File, []byte, error) {
+	file, err := openMapped(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	data, err := mapFile(file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, data, nil
+}
+
+// moving the buffer over to the file at name, which holds the same text, and
+// letting go of the mapping it was reading from
+func (e *Editor) remap(name string) error {
+	file, data, err := mapPath(name)
+	if err != nil {
+		return err
+	}
+	e.buffer = NewPieceTable(data)
+	e.unmap()
+	e.mapped, e.mapping = file, data
+	return nil
+}
+
+// letting go of the mapping of a large file, once the buffer no longer reads from it
+func (e *Editor) unmap() {
+	if e.mapped == nil {
+		return
+	}
+	unmapFile(e.mapping)
+	e.mapped.Close()
+	e.mapped, e.mapping = nil, nil
+}
+
+// whether the mapped file got shorter than the mapping
+func (e *Editor) mappingShrunk() bool {
+	if !e.largeFile || e.mapped == nil {
+		return false
+	}
+	info, err := e.mapped.Stat()
+	return err == nil && info.Size() < int64(len(e.mapping))
+}
+
+// reading a large file again when another program cut it short, before anything
+// reads the part of the mapping that is gone. It returns whether it did.
+func (e *Editor) checkMapping() bool {
+	if !e.mappingShrunk() {
+		return false
+	}
+	// the edits can't be saved without the text they were made to, so they go too
+	if err := e.reload(); err != nil {
+		e.largeFile = false
+		e.writeEditor("")
+		e.resetUndo()
+		e.message = filename + " was cut short by another program and can't be read again: " + err.Error()
+		return true
+	}
+	e.message = filename + " was cut short by another program and was read again, unsaved changes are lost"
+	return true
+}
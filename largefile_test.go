@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+// a large file of the test's own, with the settings put back after
+func setupLargeFile(t *testing.T) (string, string) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	old, oldName := settings, filename
+	t.Cleanup(func() { settings, filename = old, oldName })
+	settings.LargeFileSize = 1 << 10
+	text := strings.Repeat("a line of the log\n", 1000)
+	path := filepath.Join(t.TempDir(), "big.log")
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, text
+}
+
+func TestTruncatedLargeFileIsReadAgain(t *testing.T) {
+	path, _ := setupLargeFile(t)
+	e := openTest(t, path)
+	if !e.largeFile {
+		t.Fatal("the file didn't open in large file mode")
+	}
+	if e.checkMapping() {
+		t.Fatal("the mapping counts as cut short before anything changed")
+	}
+	e.edit(0, 0, "new ")
+	if err := os.Truncate(path, 5); err != nil {
+		t.Fatal(err)
+	}
+	if !e.checkMapping() {
+		t.Fatal("the truncated file wasn't noticed")
+	}
+	if got := e.buffer.String(); got != "a lin" {
+		t.Errorf("the buffer holds %q after reading the file again", got)
+	}
+}
+
+func TestLargeFileSavedAsGzip(t *testing.T) {
+	path, text := setupLargeFile(t)
+	dir := filepath.Dir(path)
+	e := openTest(t, path)
+	if !e.SaveAs(filepath.Join(dir, "big.log.gz")) {
+		t.Fatalf("saving failed: %s", e.message)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "big.log.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, kind, err := decompress(data)
+	if err != nil || kind != "gzip" || string(plain) != text {
+		t.Errorf("the saved file is %s with %d bytes in it, %v", kind, len(plain), err)
+	}
+}
+
+func TestSavedLargeFileIsMappedAgain(t *testing.T) {
+	path, text := setupLargeFile(t)
+	e := openTest(t, path)
+	e.edit(0, 0, "new ")
+	if err := e.SaveFile(); err != nil {
+		t.Fatal(err)
+	}
+	mapped, err := e.mapped.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(mapped, saved) {
+		t.Error("the buffer still reads from the file that was replaced")
+	}
+	if got := e.buffer.String(); got != "new "+text {
+		t.Errorf("the buffer holds %d bytes after saving, want %d", len(got), len("new "+text))
+	}
+	e.Undo()
+	if got := e.buffer.String(); got != text {
+		t.Error("undo after saving didn't give the text back")
+	}
+}
+
+func TestMappingFaultPanics(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("a mapped file can't be cut short here")
+	}
+	path, _ := setupLargeFile(t)
+	e := openTest(t, path)
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if recover() == nil {
+			t.Error("reading the lost end of the mapping didn't panic")
+		}
+	}()
+	_ = e.buffer.String()
+}
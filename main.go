@@ -4,13 +4,21 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime/debug"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/nsf/termbox-go"
+	"github.com/rivo/uniseg"
 	"golang.design/x/clipboard"
 )
 
@@ -36,6 +44,53 @@ type ColorDetails struct {
 	Color string `json:"color"`
 }
 
+// editor settings, read from the same config.json as the colors
+type Settings struct {
+	TabWidth  int                         `json:"tabWidth"`
+	FileTypes map[string]FileTypeSettings `json:"filetypes"`
+	// whether unsaved changes are journaled to a swap file, and how many seconds apart
+	Swap         bool `json:"swap"`
+	SwapInterval int  `json:"swapInterval"`
+	// files at least this many bytes long are opened in large file mode, 0 turns it off
+	LargeFileSize int64 `json:"largeFileSize"`
+	// what is kept of a file before a save overwrites it: "off", "tilde" for name~ or
+	// "dir" for timestamped copies in BackupDir, of which BackupKeep are kept
+	Backup     string `json:"backup"`
+	BackupDir  string `json:"backupDir"`
+	BackupKeep int    `json:"backupKeep"`
+	// seconds without a key press before a modified buffer is saved, and it is saved
+	// on quit instead of asking. 0 turns autosave off
+	Autosave int `json:"autosave"`
+	// the transforms run on the text before it is saved, see transform.go
+	OnSave []string `json:"onSave"`
+	// whether the undo history of a file is kept between sessions, see undofile.go
+	UndoFile bool `json:"undoFile"`
+}
+
+// settings for one type of file, keyed by its extension (or its name when it has none)
+type FileTypeSettings struct {
+	TabWidth int `json:"tabWidth"`
+	// "tabs" makes the Tab key insert a tab, anything else inserts spaces
+	Indent string `json:"indent"`
+	// the transforms run before saving, in place of the ones in Settings
+	OnSave []string `json:"onSave"`
+}
+
+var settings = Settings{
+	TabWidth:      4,
+	Swap:          true,
+	SwapInterval:  4,
+	UndoFile:      true,
+	LargeFileSize: 64 << 20,
+	Backup:        "off",
+	BackupKeep:    5,
+	FileTypes: map[string]FileTypeSettings{
+		"go":       {Indent: "tabs"},
+		"makefile": {Indent: "tabs"},
+		"mk":       {Indent: "tabs"},
+	},
+}
+
 var wordList = map[string]string{
 	"if":        "statement",
 	"else":      "statement",
@@ -112,15 +167,18 @@ var ColorToAttrib = map[string]termbox.Attribute{
 	"BrightWhite":   termbox.ColorWhite | termbox.AttrBold,
 }
 
-func loadConfig() {
-	jsonData, _ := ioutil.ReadFile("config.json")
+// reading the colors and settings from a config file, whatever it leaves out keeps its default
+func loadConfig(path string) error {
+	jsonData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
 
 	// Parse the JSON data into the ColorMapping struct
 	var colorMapping ColorMapping
-	err := json.Unmarshal(jsonData, &colorMapping)
+	err = json.Unmarshal(jsonData, &colorMapping)
 	if err != nil {
-		fmt.Println("Error parsing JSON:", err)
-		return
+		return fmt.Errorf("%s: %v", path, err)
 	}
 	// Create a map with the types and their colors
 	colors = map[string]termbox.Attribute{
@@ -134,28 +192,119 @@ func loadConfig() {
 		"declaration":   ColorToAttrib[colorMapping.Declarations.Color.Color],
 		"FnDeclaration": ColorToAttrib[colorMapping.FnDeclarations.Color.Color],
 	}
+	// settings missing from the file keep their defaults
+	err = json.Unmarshal(jsonData, &settings)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// the name settings are looked up by for a file, its extension or its name if it has none
+func fileType(name string) string {
+	ext := strings.TrimPrefix(filepath.Ext(name), ".")
+	if ext == "" {
+		ext = filepath.Base(name)
+	}
+	return strings.ToLower(ext)
+}
+
+// how many cells apart the tab stops are for the open file
+func (e *Editor) tabWidth() int {
+	if ft, ok := settings.FileTypes[fileType(filename)]; ok && ft.TabWidth > 0 {
+		return ft.TabWidth
+	}
+	if settings.TabWidth > 0 {
+		return settings.TabWidth
+	}
+	return 4
+}
+
+// whether the Tab key inserts spaces instead of a tab for the open file
+func (e *Editor) expandTab() bool {
+	return settings.FileTypes[fileType(filename)].Indent != "tabs"
 }
 
 // defining the structure of the text editor
 type Action struct {
+	// where the edit happened, in bytes from the start of the buffer, and the
+	// text it took out and put in there. Undoing puts Removed back in place of
+	// Inserted, so every action can be taken back exactly
+	Offset   int
+	Removed  string
+	Inserted string
+	// the cursor before and after the edit, as a line and a byte column
 	CursorX    int
-	CursorXEND int
 	CursorY    int
+	CursorXEND int
 	CursorYEND int
-	Text       string
-	remove     bool
+	// when the edit was made
+	Time time.Time
+	// for an edit that also changed how the text is written, the format before
+	// and after it. Undo and redo put them back, nil for every other edit
+	FormatBefore *FileFormat
+	FormatAfter  *FileFormat
+	// identifies the state of the buffer right after the action, and the state it was made in
+	id     int
+	parent int
+	// actions with the same group are undone and redone together, it is the id of the first one
+	group int
 }
 
 type Editor struct {
-	buffer     []string
+	buffer     *PieceTable
 	UndoBuffer []Action
 	RedoBuffer []Action
-	cursorX    int
-	cursorY    int
-	offsetX    int
-	offsetY    int
-	width      int
-	height     int
+	// every action ever made in the buffer, the undo tree
+	history []Action
+	cursorX int
+	cursorY int
+	offsetX int
+	offsetY int
+	width   int
+	height  int
+	// how the file is stored on disk, the buffer itself is always UTF-8 with \n line endings
+	format FileFormat
+	// shown in place of the stat bar until the next key press
+	message string
+	// the last id given to an action, and the state and format of the buffer when it was last saved
+	lastActionID int
+	savedID      int
+	savedFormat  FileFormat
+	// how many undo groups are open, and the group the actions in them join
+	groupDepth int
+	openGroup  int
+	// the swap file being journaled to, and the state and time it was last written
+	swapFile string
+	swapID   int
+	swapTime time.Time
+	noSwap   bool
+	// the open file as it was on disk when it was last read or saved
+	disk diskState
+	// set for files opened in large file mode, see largefile.go
+	largeFile bool
+	// the mapping the buffer of a large file reads from, and the file under it
+	mapping    []byte
+	mapped     *os.File
+	lastSearch string
+	// filter mode writes the buffer to stdout on quit, see pipe.go
+	filter      bool
+	filterWrite bool
+	// when a key was last pressed, and the state autosave last failed to save
+	lastInput      time.Time
+	autosaveFailed int
+	// the passphrase of an encrypted file, see crypt.go. These buffers never go
+	// to a swap file, a backup or anywhere else on disk in plain text
+	passphrase []byte
+	// the hex view of a binary file, nil for text, see hex.go
+	hex *hexView
+	// set when the file can't be written or -R was given, edits are refused
+	readOnly bool
+	// set while saving once the user agreed to overwrite a file that can't be replaced, see save.go
+	overwrite bool
+	// the files given on the command line and which of them is open, see cli.go
+	files     []fileArg
+	fileIndex int
 }
 
 // creating the editor
@@ -164,83 +313,278 @@ func NewEditor() *Editor {
 	width -= 7
 	height -= 1
 	return &Editor{
-		buffer:     []string{""},
-		UndoBuffer: []Action{},
-		RedoBuffer: []Action{},
-		cursorX:    0,
-		cursorY:    0,
-		offsetX:    0,
-		offsetY:    0,
-		width:      width,
-		height:     height,
-	}
-}
-
-// Saving the text to the file
-func (e *Editor) SaveFile() {
-	if filename != "" {
-		//if the file already exists just truncate
-		file, err := os.Create(filename)
-		if err != nil {
-			panic(err)
+		buffer:      NewPieceTable(nil),
+		UndoBuffer:  []Action{},
+		RedoBuffer:  []Action{},
+		cursorX:     0,
+		cursorY:     0,
+		offsetX:     0,
+		offsetY:     0,
+		width:       width,
+		height:      height,
+		format:      defaultFormat,
+		savedFormat: defaultFormat,
+		// no state has failed to autosave yet, 0 is the state of an unedited buffer
+		autosaveFailed: -1,
+	}
+}
+
+// Saving the text to the file, on failure the file on disk is left as it was
+func (e *Editor) SaveFile() error {
+	if filename == "" {
+		return errors.New("no file name")
+	}
+	if err := e.applyTransforms(); err != nil {
+		return err
+	}
+	return e.writeBuffer()
+}
+
+// writing the buffer to the file as it is, without running the onSave transforms
+func (e *Editor) writeBuffer() error {
+	if filename == "" {
+		return errors.New("no file name")
+	}
+	if err := e.backup(); err != nil {
+		return fmt.Errorf("backup failed, the file was left alone: %v", err)
+	}
+	if e.largeFile {
+		if err := e.saveLargeFile(); err != nil {
+			return err
 		}
-		defer file.Close()
-		//join all the lines into one string and writing to the file
-		text := strings.Join(e.buffer, "\n")
-		_, err = file.WriteString(text)
-		if err != nil {
-			panic(err)
+		e.savedID = e.stateID()
+		return nil
+	}
+	//writing all the text to the file in the format it was read in
+	data := encodeFile(e.buffer.String(), e.format)
+	if e.hex != nil {
+		// the hex view holds the bytes of the file as they are
+		data = []byte(e.buffer.String())
+	}
+	data, err := e.pack(data)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(filename, data, 0644)
+	var inPlace *inPlaceError
+	if errors.As(err, &inPlace) && e.overwrite {
+		err = writeFileInPlace(filename, data)
+	}
+	if err != nil {
+		return err
+	}
+	e.recordDisk(filename, data)
+	e.savedID = e.stateID()
+	e.savedFormat = e.format
+	e.writeUndo()
+	return nil
+}
+
+// SaveFile, and when the file can't be replaced by a new one asking whether to
+// overwrite it where it is instead
+func (e *Editor) saveOrOverwrite() error {
+	err := e.SaveFile()
+	var inPlace *inPlaceError
+	if !errors.As(err, &inPlace) || e.largeFile {
+		return err
+	}
+	if e.Ask(inPlace.Error()+", overwrite "+filename+" where it is? A full disk or a crash would leave it half written (y)es (n)o", "yn") != 'y' {
+		return err
+	}
+	e.overwrite = true
+	defer func() { e.overwrite = false }()
+	// the transforms already ran
+	return e.writeBuffer()
+}
+
+// saving to the open file, or asking for a name if there isn't one yet. It returns whether the file was saved
+func (e *Editor) Save() bool {
+	if filename == "" {
+		return e.SaveAs("")
+	}
+	if e.readOnly {
+		if e.Ask(filename+" is read-only, save it under another name? (y)es (n)o", "yn") != 'y' {
+			return false
 		}
+		return e.SaveAs("")
+	}
+	if e.format.Encrypted && !e.confirmPassphrase() {
+		return false
+	}
+	if changed, _ := e.diskChanged(); changed && e.Ask(filename+" changed on disk since it was read, overwrite it? (y)es (n)o", "yn") != 'y' {
+		return false
+	}
+	if err := e.saveOrOverwrite(); err != nil {
+		e.message = "could not save: " + err.Error()
+		return false
+	}
+	e.message = "saved " + filename
+	return true
+}
 
-	} else {
-		//if no file is specified then create untitled.txt
-		file, err := os.Create("untitled.txt")
-		if err != nil {
-			panic(err)
+// saving to a new file which then becomes the open file, the name is asked for when it is empty
+func (e *Editor) SaveAs(name string) bool {
+	if name == "" {
+		var ok bool
+		name, ok = e.PromptFile("save as: ", filename)
+		if !ok || name == "" {
+			return false
 		}
-		defer file.Close()
-		text := strings.Join(e.buffer, "\n")
-		_, err = file.WriteString(text)
-		if err != nil {
-			panic(err)
+	}
+	if info, err := os.Stat(name); err == nil {
+		if info.IsDir() {
+			e.message = name + " is a directory"
+			return false
+		}
+		current, err := os.Stat(filename)
+		if (err != nil || !os.SameFile(info, current)) && e.Ask(name+" already exists, overwrite it? (y)es (n)o", "yn") != 'y' {
+			return false
 		}
 	}
+	if e.format.Encrypted && !e.confirmPassphrase() {
+		return false
+	}
+	previous, format := filename, e.format
+	filename = name
+	// the name decides whether the new file is compressed
+	e.format.Compression = compressionForName(name)
+	if err := e.saveOrOverwrite(); err != nil {
+		filename, e.format = previous, format
+		e.message = "could not save: " + err.Error()
+		return false
+	}
+	// the copy was just written, so it can be edited
+	e.readOnly = false
+	e.message = "saved " + filename
+	return true
+}
+
+// whether the buffer differs from what was last saved
+func (e *Editor) Modified() bool {
+	return e.stateID() != e.savedID || e.format != e.savedFormat
+}
+
+// refusing to change a read-only buffer, it returns true and says so on the stat bar if it is
+func (e *Editor) refuseEdit() bool {
+	if !e.readOnly {
+		return false
+	}
+	e.message = "the buffer is read-only, the readonly command allows editing it"
+	return true
+}
+
+// checking for unsaved changes before quitting, it returns false if the editor should stay open
+func (e *Editor) confirmQuit() bool {
+	if e.filter && filename == "" {
+		// the text came from the pipe and goes back into it, there is no file to save
+		return e.confirmFilter()
+	}
+	if e.filter && !e.confirmFilter() {
+		return false
+	}
+	return e.confirmSave("quitting")
+}
+
+// offering to save unsaved changes before doing something that throws the buffer away,
+// it returns false if the user changed their mind
+func (e *Editor) confirmSave(doing string) bool {
+	if !e.Modified() {
+		return true
+	}
+	if e.canAutosave() {
+		// saved the way autosave does it, without the transforms or any questions
+		if changed, _ := e.diskChanged(); !changed && e.writeBuffer() == nil {
+			return true
+		}
+	}
+	switch e.Ask("save changes before "+doing+"? (y)es (n)o (c)ancel", "ync") {
+	case 'y':
+		return e.Save()
+	case 'n':
+		return true
+	}
+	return false
 }
 
 // adding text from file to screen
 func (e *Editor) writeEditor(data string) {
-	data = strings.Replace(data, "\t", "    ", -1)
-	//turn data from string into an array and display to screen
-	items := strings.Split(data, "\n")
-	e.buffer = items
+	//put the data into the text store and display to screen
+	e.buffer = NewPieceTable([]byte(data))
+	e.unmap()
 	termbox.Flush()
 }
 
-// reading file from command line arguments
-func (e *Editor) ReadFile(filename string) {
+// reading a file into the buffer. A file that doesn't exist yet gives an empty
+// buffer, it is only created when it is saved.
+func (e *Editor) ReadFile(filename string) error {
+	// files over the size limit are mapped instead of read
+	if info, err := os.Stat(filename); err == nil && isLargeFile(info) && !startsPacked(filename) {
+		if err := e.readLargeFile(filename, info); err != nil {
+			return readError(filename, err)
+		}
+		return nil
+	}
 	// Try to read the file
 	data, err := ioutil.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		e.format = defaultFormat
+		e.savedFormat = defaultFormat
+		e.disk = diskState{}
+		e.largeFile = false
+		e.hex = nil
+		e.writeEditor("")
+		e.setPacking(compressionForName(filename), false)
+		e.message = "new file, it is created when you save it"
+		return nil
+	}
 	if err != nil {
+		return readError(filename, err)
+	}
+	raw := data
+	data, compression, encrypted, err := e.unpack(filename, raw)
+	var notCompressed *notCompressedError
+	if err != nil && !errors.As(err, &notCompressed) {
+		return readError(filename, err)
+	}
+	e.recordDisk(filename, raw)
+	if isBinary(data) {
+		e.openHex(data)
+	} else {
+		e.openText(data)
+	}
+	e.setPacking(compression, encrypted)
+	if notCompressed != nil {
+		e.message = filename + " " + notCompressed.Error()
+	}
+	return nil
+}
 
-		// If file does not exist, create a new one
-		if os.IsNotExist(err) {
-			// Create the file
-			file, err := os.Create(filename)
-			if err != nil {
-				return
-			}
-			defer file.Close()
-			// Write some initial data to the file if needed
-			initialData := []byte("")
-			_, err = file.Write(initialData)
-			if err != nil {
-				return
-			}
-		}
-		return
+// putting the text of a file in the buffer, working out its line endings and encoding
+func (e *Editor) openText(data []byte) {
+	text, format := decodeFile(data)
+	e.format = format
+	e.savedFormat = format
+	e.largeFile = false
+	e.hex = nil
+	e.writeEditor(text)
+	if format.Mixed {
+		e.message = "the file has mixed line endings, they are kept as they are (lineending makes them all one kind)"
 	}
-	// File was read successfully, proceed with processing
-	e.writeEditor(string(data))
+}
+
+// an error from reading a file worded for the stat bar
+func readError(name string, err error) error {
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return fmt.Errorf("can't open %s: permission denied", name)
+	case errors.Is(err, syscall.EISDIR):
+		return fmt.Errorf("can't open %s: it is a directory", name)
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	return fmt.Errorf("can't open %s: %v", name, err)
 }
 
 func includes(line string, target string) (bool, int) {
@@ -266,21 +610,18 @@ func includes(line string, target string) (bool, int) {
 func includesStr(line string, index int) (bool, int, int) {
 	startIndex := 0
 	if line[index] != '"' && line[index] != '`' && line[index] != '\'' {
-		// Find the start index of the substring starting at the given index
+		// Find the start index of the substring by looking back from the given index
 		substring := line[:index]
-		// Reverse the substring
-		lookBack := reverseString(substring)
-		startIndex = strings.Index(lookBack, `"`)
+		startIndex = strings.LastIndex(substring, `"`)
 		if startIndex == -1 {
-			startIndex = strings.Index(lookBack, `'`)
+			startIndex = strings.LastIndex(substring, `'`)
 			if startIndex == -1 {
-				startIndex = strings.Index(lookBack, "`")
+				startIndex = strings.LastIndex(substring, "`")
 				if startIndex == -1 {
 					return false, 0, 0
 				}
 			}
 		}
-		startIndex = (len(lookBack) - startIndex) - 1
 
 		// Find the end index of the substring
 		endIndex := strings.Index(line[index+1:], `"`)
@@ -312,14 +653,6 @@ func includesStr(line string, index int) (bool, int, int) {
 	}
 }
 
-func reverseString(s string) string {
-	runes := []rune(s)
-	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
-		runes[i], runes[j] = runes[j], runes[i]
-	}
-	return string(runes)
-}
-
 func SyntaxHighlight(word string, index int, line string, bracket, point bool, wordType string) termbox.Attribute {
 	isString, where2, where3 := includesStr(line, index)
 	if isString == true && ((where2 <= index && where3 >= index-1) || where2 == where3) {
@@ -411,16 +744,80 @@ func getWord(line string, index int) (string, bool, bool, string) {
 	}
 }
 
-func (editor *Editor) StatBar(index int) rune {
-	lineNumber := editor.cursorY + editor.offsetY + 1        // Adding  1 because line numbers start from  1
-	columnNumber := editor.cursorX + editor.offsetX + 1      // Adding  1 because column numbers start from  1
-	formattedLineNumber := fmt.Sprintf("%d", lineNumber)     // Format line number with leading zeros
-	formattedColumnNumber := fmt.Sprintf("%d", columnNumber) // Format column number with leading zeros
-	bar := "ln: " + formattedLineNumber + " | col: " + formattedColumnNumber + " | " + filename
-	for len(bar) != editor.width {
-		bar += " "
+func (editor *Editor) StatBar() string {
+	if editor.message != "" {
+		return editor.message
+	}
+	if editor.hex != nil {
+		return editor.hexStatBar()
+	}
+	lineNumber := editor.cursorY + editor.offsetY + 1 // Adding  1 because line numbers start from  1
+	// count characters rather than bytes before the cursor
+	line := editor.buffer.Line(editor.cursorY + editor.offsetY)
+	columnNumber := clusterCount(line[:editor.cursorX+editor.offsetX]) + 1 // Adding  1 because column numbers start from  1
+	formattedLineNumber := fmt.Sprintf("%d", lineNumber)
+	formattedColumnNumber := fmt.Sprintf("%d", columnNumber)
+	name := filename
+	if name == "" {
+		name = "[no name]"
+	}
+	bar := "ln: " + formattedLineNumber + " | col: " + formattedColumnNumber + " | " + editor.format.String() + " | " + name
+	if editor.Modified() {
+		bar += " [+]"
+	}
+	if editor.largeFile {
+		bar += " [large]"
+	}
+	if editor.readOnly {
+		bar += " [RO]"
 	}
-	return rune(bar[index])
+	return bar
+}
+
+// the number of cells taken up by the line numbers and the '>' marker
+func (e *Editor) gutterWidth() int {
+	lines := e.offsetY + e.height
+	if !e.largeFile {
+		lines = e.buffer.LineCount()
+	}
+	return len(strconv.Itoa(lines)) + 3
+}
+
+// how many cells the view is scrolled to the right, measured on the cursor line
+func (e *Editor) scrollWidth() int {
+	if !e.buffer.HasLine(e.cursorY + e.offsetY) {
+		// the line went away in an edit, the view isn't scrolled to anything on it
+		return 0
+	}
+	line := e.buffer.Line(e.cursorY + e.offsetY)
+	if e.offsetX > len(line) {
+		return displayWidth(line, e.tabWidth())
+	}
+	return displayWidth(line[:e.offsetX], e.tabWidth())
+}
+
+// moving the cursor to a line and a byte column, scrolling so that it stays on screen
+func (e *Editor) setCursor(lineIndex, col int) {
+	scroll := e.scrollWidth()
+	if lineIndex < e.offsetY {
+		e.offsetY = lineIndex
+	} else if e.height > 0 && lineIndex >= e.offsetY+e.height {
+		e.offsetY = lineIndex - e.height + 1
+	}
+	e.cursorY = lineIndex - e.offsetY
+
+	line := e.buffer.Line(lineIndex)
+	// keep the same horizontal scroll if the cursor is still visible with it
+	e.offsetX = colAtWidth(line, scroll, e.tabWidth())
+	if col < e.offsetX {
+		e.offsetX = col
+	}
+	room := e.width - e.gutterWidth() - 1
+	cursorWidth := displayWidth(line[:col], e.tabWidth())
+	for e.offsetX < col && cursorWidth-displayWidth(line[:e.offsetX], e.tabWidth()) > room {
+		e.offsetX = nextBoundary(line, e.offsetX)
+	}
+	e.cursorX = col - e.offsetX
 }
 
 // rendering the text on the screen
@@ -430,18 +827,27 @@ func (e *Editor) Render() {
 	e.height -= 1
 	// Clear the screen and set the padding for the lines
 	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	if e.hex != nil {
+		e.renderHex()
+		termbox.Flush()
+		return
+	}
 	maxLineLength := e.width - 2
-	lineCountDigits := len(strconv.Itoa(len(e.buffer)))
-	lineCountWidth := lineCountDigits + 1 // +1 for the space between line count and '>'
+	lineCountWidth := e.gutterWidth() - 2 // the digits and the space between line count and '>'
+	scroll := e.scrollWidth()
 
-	for i, line := range e.buffer {
+	for i := 0; e.buffer.HasLine(i + e.offsetY); i++ {
 		if i < e.height {
 			var side rune = ' '
-			if i < len(e.buffer)-e.offsetY {
-				line = e.buffer[i+e.offsetY]
+			line := e.buffer.Line(i + e.offsetY)
+			paddedLine := line
+			if e.largeFile {
+				// line endings are left alone in large files, don't draw the CR of a CRLF
+				line = strings.TrimSuffix(line, "\r")
+			} else {
+				// Pad the line with spaces to reach the maximum line length
+				paddedLine = fmt.Sprintf("%-*s", maxLineLength, line)
 			}
-			// Pad the line with spaces to reach the maximum line length
-			paddedLine := fmt.Sprintf("%-*s", maxLineLength, line)
 			if e.cursorY == i {
 				side = '>'
 			}
@@ -454,411 +860,241 @@ func (e *Editor) Render() {
 			}
 			termbox.SetCell(lineCountWidth, i, side, termbox.ColorYellow, termbox.ColorDefault)
 			termbox.SetCell(lineCountWidth+1, i, ' ', termbox.ColorDefault, termbox.ColorDefault)
-			// Change characters based on line length
-			for j, _ := range paddedLine {
-				if j < len(paddedLine)-e.offsetX {
-					word, bracket, point, WordType := getWord(paddedLine, j+(e.offsetX))
-					wordColor := SyntaxHighlight(word, j+e.offsetX, paddedLine, bracket, point, WordType)
-					termbox.SetCell(j+lineCountWidth+2, i, rune(paddedLine[j+e.offsetX]), wordColor, termbox.ColorDefault)
+			// Draw the line one character at a time, skipping the cells scrolled off to the left
+			x := lineCountWidth + 2
+			cells := 0
+			g := uniseg.NewGraphemes(line)
+			for g.Next() {
+				start, _ := g.Positions()
+				width := cellWidth(g.Str(), cells, e.tabWidth())
+				if cells < scroll {
+					cells += width
+					if cells > scroll {
+						// a wide character cut in half by the edge, leave the visible half blank
+						x += cells - scroll
+					}
+					continue
+				}
+				if x+width > e.width {
+					break
+				}
+				if g.Str() == "\t" {
+					// tabs are drawn as the blank cells up to the next tab stop
+					x += width
+					cells += width
+					continue
 				}
+				wordColor := termbox.ColorDefault
+				if !e.largeFile {
+					word, bracket, point, WordType := getWord(paddedLine, start)
+					wordColor = SyntaxHighlight(word, start, paddedLine, bracket, point, WordType)
+				}
+				termbox.SetCell(x, i, clusterRune(g.Str()), wordColor, termbox.ColorDefault)
+				x += width
+				cells += width
 			}
 		}
 		if i == e.height {
 			break
 		}
 	}
-	for j := 0; j < e.width; j++ {
-		termbox.SetCell(j, e.height, rune(e.StatBar(j)), termbox.ColorBlack, termbox.ColorWhite)
-	}
+	e.drawStatBar()
+	// the cursor sits after the cells taken by the visible text before it
+	line := e.buffer.Line(e.cursorY + e.offsetY)
+	termbox.SetCursor(displayWidth(line[:e.cursorX+e.offsetX], e.tabWidth())-scroll+lineCountWidth+2, e.cursorY)
 	termbox.Flush()
-	termbox.SetCursor(e.cursorX+lineCountWidth+2, e.cursorY)
+}
+
+// drawing the stat bar on the last row of the screen
+func (e *Editor) drawStatBar() {
+	end := drawString(0, e.height, e.width, e.StatBar(), termbox.ColorBlack, termbox.ColorWhite)
+	for j := end; j < e.width; j++ {
+		termbox.SetCell(j, e.height, ' ', termbox.ColorBlack, termbox.ColorWhite)
+	}
 }
 
 // add character to line
 func (e *Editor) AppendCharacter(char rune) {
-	// Get the current line and cursor position
-	lineIndex := e.cursorY + e.offsetY
-	cursorPositionX := e.cursorX + e.offsetX
-	cursorPositionY := e.cursorY + e.offsetY
-
-	e.buffer[lineIndex] = e.buffer[lineIndex][:cursorPositionX] + string(char) + e.buffer[lineIndex][cursorPositionX:]
-
-	// Update the cursor position
-	e.cursorX++
-	if e.cursorX > e.width-7 {
-		e.offsetX++
-		e.cursorX = e.width - 7
-	}
-
-	// Record the action in the UndoBuffer
-	e.UndoBuffer = append(e.UndoBuffer, Action{
-		CursorX:    cursorPositionX,
-		CursorXEND: e.cursorX + e.offsetX,
-		CursorY:    cursorPositionY,
-		CursorYEND: e.cursorY + e.offsetY,
-		Text:       string(char),
-		remove:     false,
-	})
-}
-func (e *Editor) Redo() {
-	// Check if there are actions to redo
-	if len(e.RedoBuffer) == 0 {
-		return
-	}
+	e.insert(string(char))
+}
 
-	// Pop the last action from the RedoBuffer
-	action := e.RedoBuffer[len(e.RedoBuffer)-1]
-	e.RedoBuffer = e.RedoBuffer[:len(e.RedoBuffer)-1]
+// moving the cursor to another line, staying in the same screen column where the line is long enough
+func (e *Editor) moveLine(lineIndex int) {
+	line := e.buffer.Line(e.cursorY + e.offsetY)
+	width := displayWidth(line[:e.cursorX+e.offsetX], e.tabWidth())
+	e.setCursor(lineIndex, colAtWidth(e.buffer.Line(lineIndex), width, e.tabWidth()))
+}
 
-	// Perform the redo action
-	if action.remove {
-		// If the action was a remove action, remove the text from the buffer
-		if action.Text != "\n" {
-			e.buffer[action.CursorY] = e.buffer[action.CursorY][:action.CursorX-1] + e.buffer[action.CursorY][action.CursorX:]
-		} else {
-			e.buffer[action.CursorY] = e.buffer[action.CursorY][:action.CursorX-1] + e.buffer[action.CursorY][action.CursorX-1:]
-		}
+func (editor *Editor) Enter() {
+	// the newline splits the line, everything after the cursor moves to the next line
+	editor.insert("\n")
+}
 
-		// If the action was removing a newline, merge the current line with the next line
-		if action.Text == "\n" && action.CursorY < len(e.buffer)-1 {
-			e.buffer[action.CursorY] += e.buffer[action.CursorY+1]
-			e.buffer = append(e.buffer[:action.CursorY+1], e.buffer[action.CursorY+2:]...)
+func main() {
+	filter := flag.Bool("filter", false, "write the buffer to stdout on quit, reading stdin if no file is given")
+	configPath := flag.String("config", "", "read the config from `path` instead of ./config.json")
+	clean := flag.Bool("clean", false, "don't read any config, use the defaults")
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	flag.BoolVar(&openReadOnly, "R", false, "open the files read-only")
+	flag.Usage = usage
+	flag.Parse()
+	args := flag.Args()
+	if *showVersion {
+		fmt.Println("slik", version)
+		return
+	}
+	// the config decides how files are opened, so it is loaded first. A config that
+	// was asked for has to be there, the default one is optional.
+	var configErr error
+	switch {
+	case *clean:
+	case *configPath != "":
+		if err := loadConfig(*configPath); err != nil {
+			fmt.Fprintln(os.Stderr, "slik:", err)
+			os.Exit(1)
 		}
-	} else {
-		// If the action was an add action, add the text back to the buffer
-		e.buffer[action.CursorY] = e.buffer[action.CursorY][:action.CursorX] + action.Text + e.buffer[action.CursorY][action.CursorX:]
-		if action.Text == "\n" {
-			// Split the line at the cursor position
-			before := e.buffer[action.CursorY][:action.CursorX]
-			after := e.buffer[action.CursorY][action.CursorX:]
-			// Insert a new line with the text after the cursor
-			e.buffer = append(e.buffer[:action.CursorY+1], append([]string{after}, e.buffer[action.CursorY+1:]...)...)
-			// Replace the current line with the text before the cursor
-			e.buffer[action.CursorY] = before
+	default:
+		if err := loadConfig("config.json"); !errors.Is(err, fs.ErrNotExist) {
+			configErr = err
+		}
+	}
+	// a pipe has to be read before termbox takes over the terminal
+	var stdin []byte
+	if len(args) > 0 && args[0] == "-" || *filter && len(args) == 0 {
+		if stdinIsTerminal() {
+			fmt.Fprintln(os.Stderr, "slik: nothing is piped into stdin, give a file or pipe the text in")
+			flag.Usage()
+			os.Exit(2)
+		}
+		var err error
+		stdin, err = readStdin()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "slik: reading stdin:", err)
+			os.Exit(1)
 		}
 	}
 
-	// Add the redone action to the UndoBuffer
-	e.UndoBuffer = append(e.UndoBuffer, action)
-}
-func (editor *Editor) Enter() {
-	var nextText string = ""
-	CursorPosX, CursorPosY := editor.cursorX+editor.offsetX, editor.cursorY+editor.offsetY
-	if editor.cursorX+editor.offsetX < len(editor.buffer[editor.cursorY+editor.offsetY]) {
-		nextText = editor.buffer[editor.cursorY+editor.offsetY][editor.cursorX+editor.offsetX:]
-		editor.buffer[editor.cursorY+editor.offsetY] = editor.buffer[editor.cursorY+editor.offsetY][:editor.cursorX+editor.offsetX]
-	}
-	editor.buffer = append(editor.buffer[:editor.cursorY+1+editor.offsetY], append([]string{""}, editor.buffer[editor.cursorY+1+editor.offsetY:]...)...)
-	editor.cursorY++
-	editor.buffer[editor.cursorY+editor.offsetY] = nextText
-	editor.cursorX = 0
-	editor.offsetX = 0
-	if editor.cursorY > editor.height-1 {
-		editor.offsetY += 1
-		editor.cursorY = editor.height - 1
-	}
-	editor.UndoBuffer = append(editor.UndoBuffer, Action{
-		CursorX:    CursorPosX,
-		CursorXEND: editor.cursorX + editor.offsetX,
-		CursorY:    CursorPosY,
-		CursorYEND: editor.cursorY + editor.offsetY,
-		Text:       "\n",
-		remove:     false,
-	})
-}
-
-func main() {
 	//Initiate IDE
 	err := termbox.Init()
 	if err != nil {
 		panic(err)
 	}
+	startEvents()
 
 	editor := NewEditor()
+	editor.filter = *filter
+	// reading a mapped file that another program cut short faults, it panics
+	// into the recover below instead of killing slik, see largefile.go
+	debug.SetPanicOnFault(true)
+	defer func() {
+		// on a crash get the unsaved changes to the swap file before anything else
+		r := recover()
+		if r != nil {
+			editor.writeSwap()
+		}
+		termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+		termbox.Close()
+		if r != nil {
+			fmt.Fprintf(os.Stderr, "slik crashed: %v\n%s", r, debug.Stack())
+			if editor.swapFile != "" {
+				fmt.Fprintln(os.Stderr, "unsaved changes were written to", editor.swapFile)
+			}
+			os.Exit(2)
+		}
+		if editor.filter {
+			os.Exit(editor.finishFilter())
+		}
+	}()
 	err = clipboard.Init()
 	if err != nil {
 		panic(err)
 	}
 	//Check if a file is specified
-	if len(os.Args) > 1 {
-		editor.ReadFile(os.Args[1])
-		filename = os.Args[1]
+	if stdin != nil {
+		editor.OpenStdin(stdin)
+	} else if editor.files = parseFileArgs(args); len(editor.files) > 0 {
+		editor.openArg(0)
+	} else {
+		// the text of an unnamed buffer from a slik that crashed may be waiting
+		editor.checkSwap()
+	}
+	if configErr != nil {
+		editor.message = configErr.Error()
 	}
-	loadConfig()
 	editor.Render()
-	defer func() {
-		termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
-		termbox.Close()
-	}()
 	for {
 		//go through possible user inputs
+		ev := waitEvent(tickInterval)
+		// before the event reads a mapping that may have lost its end, the event
+		// was meant for the text as it was and is dropped
+		if editor.checkMapping() {
+			editor.Render()
+			continue
+		}
 		var currentLine int = editor.cursorY
-		switch ev := termbox.PollEvent(); ev.Type {
+		switch ev.Type {
 		case termbox.EventKey:
+			editor.message = ""
+			editor.lastInput = time.Now()
+			if editor.hex != nil && editor.hexKey(ev) {
+				break
+			}
 			switch ev.Key {
 			case termbox.KeyEsc:
-				return
-			case termbox.KeyCtrlV:
-				text := string(clipboard.Read(clipboard.FmtText))
-				CursorPosX, CursorPosY := editor.cursorX+editor.offsetX, editor.cursorY+editor.offsetY
-				if text != "" {
-					hasNewLine := false
-					count := 0
-					for _, c := range text {
-						if c == '\n' {
-							hasNewLine = true
-							count++
-						}
-					}
-					if !hasNewLine {
-						editor.buffer[editor.cursorY+editor.offsetY] = editor.buffer[editor.cursorY+editor.offsetY][:editor.cursorX+editor.offsetX] + text + editor.buffer[editor.cursorY+editor.offsetY][editor.cursorX+editor.offsetX:]
-						if editor.cursorX == editor.width-7 {
-							editor.offsetX += len(text)
-						} else {
-							editor.cursorX += len(text)
-							if editor.cursorX > editor.width-7 {
-								editor.offsetX = editor.cursorX - editor.width - 7
-								editor.cursorX = editor.width - 7
-							}
-						}
-					} else {
-						NewStr := strings.Split(text, "\n")
-						before := editor.buffer[editor.cursorY+editor.offsetY][:editor.cursorX+editor.offsetX]
-						after := editor.buffer[editor.cursorY+editor.offsetY][editor.cursorX+editor.offsetX:]
-						line := editor.offsetY + editor.cursorY
-						for i := 0; i <= count; i++ {
-							if i != 0 {
-								editor.buffer = append(editor.buffer[:editor.cursorY+editor.offsetY+1], append([]string{NewStr[i]}, editor.buffer[editor.cursorY+1+editor.offsetY:]...)...)
-								editor.cursorY++
-							} else {
-								editor.buffer = append(editor.buffer[:editor.cursorY+editor.offsetY], append([]string{NewStr[i]}, editor.buffer[editor.cursorY+1+editor.offsetY:]...)...)
-							}
-						}
-						editor.buffer[line] = before + editor.buffer[line]
-						editor.buffer[editor.cursorY+editor.offsetY] = editor.buffer[editor.cursorY+editor.offsetY] + after
-						editor.cursorX = len(editor.buffer[editor.cursorY+editor.offsetY]) - len(after)
-						if editor.cursorX > editor.width-7 {
-							editor.offsetX = editor.cursorX - editor.width - 7
-							editor.cursorX = editor.width - 7
-						}
-					}
-					editor.UndoBuffer = append(editor.UndoBuffer, Action{
-						CursorX:    CursorPosX,
-						CursorXEND: editor.cursorX + editor.offsetX,
-						CursorY:    CursorPosY,
-						CursorYEND: editor.cursorY + editor.offsetY,
-						Text:       text,
-						remove:     false,
-					})
+				if editor.confirmQuit() {
+					editor.writeUndo()
+					editor.removeSwap()
+					return
 				}
+			case termbox.KeyCtrlE:
+				if command, ok := editor.Prompt("command: "); ok {
+					editor.RunCommand(command)
+				}
+			case termbox.KeyCtrlV:
+				editor.Paste(string(clipboard.Read(clipboard.FmtText)))
 			case termbox.KeyCtrlS:
-				editor.SaveFile()
+				editor.Save()
+			case termbox.KeyCtrlO:
+				editor.SaveAs("")
+			case termbox.KeyCtrlF:
+				if text, ok := editor.Prompt("find: "); ok {
+					editor.Find(text)
+				}
+			case termbox.KeyCtrlG:
+				if text, ok := editor.Prompt("go to line: "); ok {
+					editor.RunCommand("goto " + text)
+				}
 			case termbox.KeyCtrlY:
 				editor.Redo()
 			case termbox.KeyCtrlZ:
-				if len(editor.UndoBuffer) == 0 {
-					// No actions to undo
-					continue
-				}
-
-				// Pop the last action from the UndoBuffer
-				action := editor.UndoBuffer[len(editor.UndoBuffer)-1]
-				editor.UndoBuffer = editor.UndoBuffer[:len(editor.UndoBuffer)-1]
-				// Reverse the action
-				if !action.remove {
-					if action.Text != "\n" {
-						if action.CursorY == action.CursorYEND {
-							editor.buffer[action.CursorY] = editor.buffer[action.CursorY][:action.CursorX] + editor.buffer[action.CursorY][action.CursorXEND:]
-							if len(action.Text) > editor.width-7 {
-								editor.offsetX = len(action.Text) - editor.width - 7 + editor.cursorX
-							}
-							editor.cursorX = action.CursorX
-							//editor.cursorY = action.CursorY
-						} else {
-							editor.buffer[action.CursorY] = editor.buffer[action.CursorY][:action.CursorX] + editor.buffer[action.CursorYEND][action.CursorXEND:]
-							editor.buffer = append(editor.buffer[:action.CursorY+1], editor.buffer[action.CursorYEND+1:]...)
-							editor.cursorX = action.CursorX
-						}
-					} else {
-						nextText := editor.buffer[action.CursorYEND][action.CursorXEND:]
-						copy(editor.buffer[action.CursorYEND:], editor.buffer[action.CursorYEND+1:])
-						editor.buffer = editor.buffer[:len(editor.buffer)-1]
-						editor.offsetX = 0
-						if editor.cursorX > editor.width-7 {
-							editor.offsetX = action.CursorX - editor.width - 7
-							editor.cursorX = editor.width - 7
-						}
-						editor.buffer[action.CursorY+editor.offsetY] += nextText
-						editor.cursorY--
-						editor.cursorX = len(editor.buffer[editor.cursorY+editor.offsetY])
-					}
-				} else {
-					if action.Text != "\n" {
-						editor.buffer[action.CursorY+editor.offsetY] = editor.buffer[action.CursorY][:action.CursorXEND] + action.Text + editor.buffer[action.CursorY][action.CursorXEND:]
-						if len(action.Text) > editor.width-7 {
-							editor.offsetX = len(action.Text) - editor.width - 7 + editor.cursorX
-						}
-						editor.cursorX = action.CursorXEND
-						//editor.cursorY = action.CursorY
-					} else {
-						editor.Enter()
-					}
-				}
-				if action.CursorY != editor.cursorY+editor.offsetY {
-					editor.cursorY = action.CursorY
-				}
-				if action.CursorX > editor.width-7 {
-					editor.offsetX = action.CursorX - editor.width - 7
-					editor.cursorX = editor.width - 7
-				} else if action.CursorX < editor.width-7+editor.offsetX {
-					editor.offsetX = action.CursorX - action.CursorX
-				}
-				if action.CursorY > editor.height-1 {
-					editor.offsetY = action.CursorYEND - editor.height - 1
-					editor.cursorY = editor.height - 1
-				}
-
-				// Move the action to the RedoBuffer
-				editor.RedoBuffer = append(editor.RedoBuffer, action)
+				editor.Undo()
 			case termbox.KeyEnter:
 				editor.Enter()
 			case termbox.KeyBackspace, termbox.KeyBackspace2:
-				if editor.cursorX != 0 || editor.offsetX > 0 {
-					var BACKtext string = editor.buffer[editor.cursorY+editor.offsetY][editor.cursorX+editor.offsetX-1 : editor.cursorX+editor.offsetX]
-					editor.buffer[editor.cursorY+editor.offsetY] = editor.buffer[editor.cursorY+editor.offsetY][:editor.cursorX+editor.offsetX-1] + editor.buffer[editor.cursorY+editor.offsetY][editor.cursorX+editor.offsetX:]
-					editor.cursorX--
-					if editor.offsetX > 0 && editor.cursorX == 0 {
-						editor.offsetX--
-						editor.cursorX++
-					}
-					editor.UndoBuffer = append(editor.UndoBuffer, Action{
-						CursorX:    editor.cursorX + 1,
-						CursorXEND: editor.cursorX + editor.offsetX,
-						CursorY:    editor.cursorY + editor.offsetY,
-						CursorYEND: editor.cursorY + editor.offsetY,
-						Text:       string(BACKtext),
-						remove:     true,
-					})
-				} else if editor.cursorY > 0 {
-					nextText := editor.buffer[editor.cursorY+editor.offsetY][editor.cursorX:]
-					copy(editor.buffer[editor.cursorY+editor.offsetY:], editor.buffer[editor.cursorY+1+editor.offsetY:])
-					editor.buffer = editor.buffer[:len(editor.buffer)-1]
-					editor.cursorY--
-					editor.cursorX = len(editor.buffer[editor.cursorY+editor.offsetY])
-					editor.offsetX = 0
-					editor.cursorX = len(editor.buffer[editor.cursorY+editor.offsetY])
-					if editor.cursorX > editor.width-7 {
-						editor.offsetX = editor.cursorX - editor.width - 7
-						editor.cursorX = editor.width - 7
-					}
-					editor.buffer[editor.cursorY+editor.offsetY] += nextText
-					editor.UndoBuffer = append(editor.UndoBuffer, Action{
-						CursorX:    editor.cursorX + 1,
-						CursorXEND: editor.cursorX + editor.offsetX,
-						CursorY:    editor.cursorY + editor.offsetY,
-						CursorYEND: editor.cursorY + editor.offsetY,
-						Text:       "\n",
-						remove:     true,
-					})
-				}
+				editor.Backspace()
 			case termbox.KeyDelete:
-				if editor.cursorX != len(editor.buffer[editor.cursorY+editor.offsetY]) {
-					text := editor.buffer[editor.cursorY+editor.offsetY][editor.cursorX+editor.offsetX]
-					editor.buffer[editor.cursorY+editor.offsetY] = editor.buffer[editor.cursorY+editor.offsetY][:editor.cursorX] + editor.buffer[editor.cursorY+editor.offsetY][editor.cursorX+1:]
-					editor.UndoBuffer = append(editor.UndoBuffer, Action{
-						CursorX:    editor.cursorX + 1,
-						CursorXEND: editor.cursorX + editor.offsetX,
-						CursorY:    editor.cursorY + editor.offsetY,
-						CursorYEND: editor.cursorY + editor.offsetY,
-						Text:       string(text),
-						remove:     true,
-					})
-				}
+				editor.DeleteChar()
 			case termbox.KeySpace:
-				CursorPosX, CursorPosY := editor.cursorX+editor.offsetX, editor.cursorY+editor.offsetY
-
-				editor.buffer[editor.cursorY+editor.offsetY] = editor.buffer[editor.cursorY+editor.offsetY][:editor.cursorX] + " " + editor.buffer[editor.cursorY+editor.offsetY][editor.cursorX:]
-				editor.cursorX++
-				if editor.cursorX > editor.width-7 {
-					editor.offsetX++
-					editor.cursorX--
-				}
-				editor.UndoBuffer = append(editor.UndoBuffer, Action{
-					CursorX:    CursorPosX,
-					CursorXEND: editor.cursorX + editor.offsetX,
-					CursorY:    CursorPosY,
-					CursorYEND: editor.cursorY + editor.offsetY,
-					Text:       " ",
-				})
+				editor.AppendCharacter(' ')
 			case termbox.KeyTab:
-				CursorPosX, CursorPosY := editor.cursorX+editor.offsetX, editor.cursorY+editor.offsetY
-
-				editor.buffer[editor.cursorY+editor.offsetY] = editor.buffer[editor.cursorY+editor.offsetY][:editor.cursorX] + "    " + editor.buffer[editor.cursorY+editor.offsetY][editor.cursorX:]
-				editor.cursorX += len("    ")
-				if editor.cursorX > editor.width-7 {
-					editor.offsetX++
-					editor.cursorX--
-				}
-				editor.UndoBuffer = append(editor.UndoBuffer, Action{
-					CursorX:    CursorPosX,
-					CursorXEND: editor.cursorX + editor.offsetX,
-					CursorY:    CursorPosY,
-					CursorYEND: editor.cursorY + editor.offsetY,
-					Text:       "    ",
-				})
+				editor.Tab()
 			case termbox.KeyArrowLeft:
 				if editor.cursorX > 0 || editor.offsetX > 0 {
-					editor.cursorX--
-					if editor.cursorX < 0 {
-						editor.offsetX--
-						editor.cursorX++
-					}
+					line := editor.buffer.Line(currentLine + editor.offsetY)
+					editor.setCursor(currentLine+editor.offsetY, prevBoundary(line, editor.cursorX+editor.offsetX))
 				}
 			case termbox.KeyArrowRight:
-				if editor.cursorX+editor.offsetX < len(editor.buffer[currentLine+editor.offsetY]) {
-					editor.cursorX++
-					if editor.cursorX > editor.width-7 {
-						editor.offsetX++
-						editor.cursorX--
-					}
+				if editor.cursorX+editor.offsetX < editor.buffer.LineLen(currentLine+editor.offsetY) {
+					line := editor.buffer.Line(currentLine + editor.offsetY)
+					editor.setCursor(currentLine+editor.offsetY, nextBoundary(line, editor.cursorX+editor.offsetX))
 				}
 			case termbox.KeyArrowUp:
 				if currentLine > 0 || editor.offsetY > 0 {
-					if editor.offsetY > 0 && currentLine == 0 {
-						editor.offsetY--
-					} else {
-						editor.cursorY--
-					}
-					if len(editor.buffer[editor.cursorY+editor.offsetY]) < editor.cursorX+editor.offsetX {
-						editor.offsetX = 0
-						editor.cursorX = len(editor.buffer[editor.cursorY+editor.offsetX])
-						editor.offsetX = 0
-						editor.cursorX = len(editor.buffer[editor.cursorY+editor.offsetY])
-						if editor.cursorX > editor.width-7 {
-							editor.offsetX = editor.cursorX - editor.width - 7
-							editor.cursorX = editor.width - 7
-						}
-					}
-
+					editor.moveLine(currentLine + editor.offsetY - 1)
 				}
 			case termbox.KeyArrowDown:
-				if editor.offsetY+editor.cursorY < len(editor.buffer)-1 {
-					if editor.cursorY == editor.height-1 {
-						editor.offsetX = 0
-						editor.offsetY++
-
-					} else {
-						editor.cursorY++
-					}
-					if len(editor.buffer[editor.cursorY+editor.offsetY]) < editor.cursorX+editor.offsetX {
-						editor.offsetX = 0
-						editor.cursorX = len(editor.buffer[editor.cursorY+editor.offsetY])
-						if editor.cursorX > editor.width-7 {
-							editor.offsetX = editor.cursorX - editor.width - 7
-							editor.cursorX = editor.width - 7
-						}
-					}
-
+				if editor.buffer.HasLine(editor.offsetY + editor.cursorY + 1) {
+					editor.moveLine(currentLine + editor.offsetY + 1)
 				}
 			default:
 				if ev.Ch != 0 && string(ev.Ch) != "" && string(ev.Ch) != " " {
@@ -871,6 +1107,9 @@ func main() {
 			panic(ev.Err)
 		}
 
+		editor.checkDisk()
+		editor.autosave()
+		editor.journal()
 		editor.Render()
 	}
 }
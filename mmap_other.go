@@ -0,0 +1,25 @@
+//go:build !unix && !windows
+
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// opening a file to map it
+func openMapped(name string) (*os.File, error) {
+	return os.Open(name)
+}
+
+// files can't be mapped here, the large file is read into memory instead
+func mapFile(file *os.File, size int64) ([]byte, error) {
+	data := make([]byte, size)
+	_, err := io.ReadFull(file, data)
+	return data, err
+}
+
+// there is nothing to let go of, the garbage collector takes the copy
+func unmapFile(data []byte) error {
+	return nil
+}
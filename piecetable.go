@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// a piece points at a run of bytes in either the original text or the add buffer
+type piece struct {
+	added  bool
+	start  int
+	length int
+}
+
+// PieceTable stores the text of a buffer without ever rewriting it. The text
+// the file was opened with is kept as it is, everything typed afterwards is
+// appended to a second buffer and the document is the list of pieces that
+// point into those two buffers.
+type PieceTable struct {
+	original []byte
+	added    []byte
+	pieces   []piece
+	length   int
+	// byte offset of the start of every line, nil until it is needed, and
+	// how far into the text the index has looked for newlines
+	lines   []int
+	scanned int
+}
+
+// creating a piece table holding data
+func NewPieceTable(data []byte) *PieceTable {
+	t := &PieceTable{original: data, length: len(data)}
+	if len(data) > 0 {
+		t.pieces = []piece{{added: false, start: 0, length: len(data)}}
+	}
+	return t
+}
+
+// the bytes a piece points at
+func (t *PieceTable) bytes(p piece) []byte {
+	if p.added {
+		return t.added[p.start : p.start+p.length]
+	}
+	return t.original[p.start : p.start+p.length]
+}
+
+// Len returns the length of the text in bytes
+func (t *PieceTable) Len() int {
+	return t.length
+}
+
+// find the piece that contains offset and how far into the piece it is
+func (t *PieceTable) find(offset int) (int, int) {
+	for i, p := range t.pieces {
+		if offset < p.length {
+			return i, offset
+		}
+		offset -= p.length
+	}
+	return len(t.pieces), 0
+}
+
+// Insert adds text at offset
+func (t *PieceTable) Insert(offset int, text string) {
+	if text == "" {
+		return
+	}
+	if offset < 0 || offset > t.length {
+		panic("piece table: insert out of range")
+	}
+	start := len(t.added)
+	t.added = append(t.added, text...)
+	newPiece := piece{added: true, start: start, length: len(text)}
+
+	i, inner := t.find(offset)
+	switch {
+	case inner == 0 && i > 0 && t.pieces[i-1].added && t.pieces[i-1].start+t.pieces[i-1].length == start:
+		// typing straight after the last insert just grows that piece
+		t.pieces[i-1].length += len(text)
+	case inner == 0:
+		t.pieces = append(t.pieces[:i], append([]piece{newPiece}, t.pieces[i:]...)...)
+	default:
+		// split the piece in two and put the new text between the halves
+		p := t.pieces[i]
+		left := piece{added: p.added, start: p.start, length: inner}
+		right := piece{added: p.added, start: p.start + inner, length: p.length - inner}
+		t.pieces = append(t.pieces[:i], append([]piece{left, newPiece, right}, t.pieces[i+1:]...)...)
+	}
+	t.length += len(text)
+	t.indexInsert(offset, text)
+}
+
+// Delete removes length bytes starting at offset
+func (t *PieceTable) Delete(offset, length int) {
+	if length <= 0 {
+		return
+	}
+	if offset < 0 || offset+length > t.length {
+		panic("piece table: delete out of range")
+	}
+	end := offset + length
+	pieces := make([]piece, 0, len(t.pieces)+1)
+	pos := 0
+	for _, p := range t.pieces {
+		pieceEnd := pos + p.length
+		if pieceEnd <= offset || pos >= end {
+			// the piece is completely outside of the deleted range
+			pieces = append(pieces, p)
+		} else {
+			// keep whatever part of the piece is before or after the range
+			if pos < offset {
+				pieces = append(pieces, piece{added: p.added, start: p.start, length: offset - pos})
+			}
+			if pieceEnd > end {
+				cut := end - pos
+				pieces = append(pieces, piece{added: p.added, start: p.start + cut, length: p.length - cut})
+			}
+		}
+		pos = pieceEnd
+	}
+	t.indexDelete(offset, length)
+	t.pieces = pieces
+	t.length -= length
+}
+
+// Slice returns the text between the start and end offsets
+func (t *PieceTable) Slice(start, end int) string {
+	if start < 0 {
+		start = 0
+	}
+	if end > t.length {
+		end = t.length
+	}
+	if start >= end {
+		return ""
+	}
+	var text strings.Builder
+	text.Grow(end - start)
+	pos := 0
+	for _, p := range t.pieces {
+		pieceEnd := pos + p.length
+		if pieceEnd > start && pos < end {
+			data := t.bytes(p)
+			from, to := 0, p.length
+			if start > pos {
+				from = start - pos
+			}
+			if end < pieceEnd {
+				to = end - pos
+			}
+			text.Write(data[from:to])
+		}
+		if pieceEnd >= end {
+			break
+		}
+		pos = pieceEnd
+	}
+	return text.String()
+}
+
+// String returns the whole text
+func (t *PieceTable) String() string {
+	return t.Slice(0, t.length)
+}
+
+// Snapshot returns a copy of the table that later edits will not change.
+// Both buffers are shared because neither of them is ever written over.
+func (t *PieceTable) Snapshot() *PieceTable {
+	pieces := make([]piece, len(t.pieces))
+	copy(pieces, t.pieces)
+	return &PieceTable{
+		original: t.original,
+		// capping the add buffer makes the snapshot copy it if it is ever edited
+		added:  t.added[:len(t.added):len(t.added)],
+		pieces: pieces,
+		length: t.length,
+	}
+}
+
+// how much text is scanned for newlines at a time when the line index grows
+const indexChunk = 1 << 20
+
+// make sure the line index covers everything up to offset. The index is only
+// built as far as it is needed, so opening a huge file doesn't read all of it.
+func (t *PieceTable) indexTo(offset int) {
+	if t.lines == nil {
+		t.lines = []int{0}
+		t.scanned = 0
+	}
+	if offset > t.length {
+		offset = t.length
+	}
+	pos := 0
+	for _, p := range t.pieces {
+		if t.scanned >= offset {
+			return
+		}
+		pieceEnd := pos + p.length
+		if pieceEnd > t.scanned {
+			// look for newlines in the piece, but not past offset
+			stop := min(pieceEnd, offset)
+			data := t.bytes(p)[t.scanned-pos : stop-pos]
+			for {
+				n := bytes.IndexByte(data, '\n')
+				if n == -1 {
+					break
+				}
+				t.scanned += n + 1
+				t.lines = append(t.lines, t.scanned)
+				data = data[n+1:]
+			}
+			t.scanned = stop
+		}
+		pos = pieceEnd
+	}
+}
+
+// make sure the line index knows where line ends, or that the text ends before it
+func (t *PieceTable) indexLine(line int) {
+	t.indexTo(0)
+	for len(t.lines) <= line+1 && t.scanned < t.length {
+		t.indexTo(t.scanned + indexChunk)
+	}
+}
+
+// the line that offset is on
+func (t *PieceTable) lineAt(offset int) int {
+	t.indexTo(offset)
+	lines := t.lines
+	low, high := 0, len(lines)-1
+	for low < high {
+		mid := (low + high + 1) / 2
+		if lines[mid] <= offset {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+	return low
+}
+
+// keep the line index up to date after text was inserted
+func (t *PieceTable) indexInsert(offset int, text string) {
+	if t.lines == nil {
+		return
+	}
+	line := t.lineAt(offset)
+	var added []int
+	for n := 0; n < len(text); n++ {
+		if text[n] == '\n' {
+			added = append(added, offset+n+1)
+		}
+	}
+	rest := t.lines[line+1:]
+	for n := range rest {
+		rest[n] += len(text)
+	}
+	if len(added) > 0 {
+		t.lines = append(t.lines[:line+1], append(added, rest...)...)
+	}
+	t.scanned += len(text)
+}
+
+// keep the line index up to date after text was deleted
+func (t *PieceTable) indexDelete(offset, length int) {
+	if t.lines == nil {
+		return
+	}
+	t.indexTo(offset + length)
+	// a line starting inside (offset, offset+length] lost its newline
+	first := t.lineAt(offset) + 1
+	last := first
+	for last < len(t.lines) && t.lines[last] <= offset+length {
+		last++
+	}
+	rest := t.lines[last:]
+	for n := range rest {
+		rest[n] -= length
+	}
+	t.lines = append(t.lines[:first], rest...)
+	t.scanned -= length
+}
+
+// LineCount returns the number of lines, an empty text still has one line.
+// It has to look at the whole text, HasLine is cheaper for huge files.
+func (t *PieceTable) LineCount() int {
+	t.indexTo(t.length)
+	return len(t.lines)
+}
+
+// HasLine reports whether the text has a line with the given index
+func (t *PieceTable) HasLine(line int) bool {
+	t.indexLine(line)
+	return line >= 0 && line < len(t.lines)
+}
+
+// LineStart returns the offset of the first byte of a line
+func (t *PieceTable) LineStart(line int) int {
+	t.indexLine(line)
+	return t.lines[line]
+}
+
+// LineEnd returns the offset of the newline that ends a line, or the end of the text
+func (t *PieceTable) LineEnd(line int) int {
+	t.indexLine(line)
+	if line+1 < len(t.lines) {
+		return t.lines[line+1] - 1
+	}
+	return t.length
+}
+
+// LineLen returns the length of a line in bytes without its newline
+func (t *PieceTable) LineLen(line int) int {
+	return t.LineEnd(line) - t.LineStart(line)
+}
+
+// Line returns the text of a line without its newline
+func (t *PieceTable) Line(line int) string {
+	return t.Slice(t.LineStart(line), t.LineEnd(line))
+}
+
+// Index returns the offset of the first match of text at or after from, or -1
+func (t *PieceTable) Index(text string, from int) int {
+	if text == "" {
+		return -1
+	}
+	// search a chunk at a time, the chunks overlap so matches across the edges are found
+	for pos := from; pos < t.length; pos += indexChunk {
+		n := strings.Index(t.Slice(pos, pos+indexChunk+len(text)-1), text)
+		if n != -1 {
+			return pos + n
+		}
+	}
+	return -1
+}
+
+// WriteTo writes the whole text to w without building it as one string
+func (t *PieceTable) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for _, p := range t.pieces {
+		n, err := w.Write(t.bytes(p))
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Offset turns a line and a byte column into an offset
+func (t *PieceTable) Offset(line, col int) int {
+	return t.LineStart(line) + col
+}
+
+// Position turns an offset into a line and a byte column
+func (t *PieceTable) Position(offset int) (int, int) {
+	line := t.lineAt(offset)
+	return line, offset - t.LineStart(line)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// the offsets the lines of text start at, worked out the slow way
+func lineStarts(text string) []int {
+	starts := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+// a string of up to n bytes with plenty of newlines in it
+func randomText(r *rand.Rand, n int) string {
+	parts := []string{"a", "bc", "\n", "\n\n", "é", "word "}
+	var b strings.Builder
+	for b.Len() < n {
+		b.WriteString(parts[r.Intn(len(parts))])
+	}
+	return b.String()[:n]
+}
+
+// checking everything the table knows about its text against want
+func checkTable(t *testing.T, table *PieceTable, want string) {
+	t.Helper()
+	if table.Len() != len(want) || table.String() != want {
+		t.Fatalf("the table holds %q, want %q", table.String(), want)
+	}
+	starts := lineStarts(want)
+	if table.LineCount() != len(starts) {
+		t.Fatalf("the table has %d lines, want %d", table.LineCount(), len(starts))
+	}
+	for line, start := range starts {
+		end := len(want)
+		if line+1 < len(starts) {
+			end = starts[line+1] - 1
+		}
+		if gotLine, gotCol := table.Position(end); gotLine != line || gotCol != end-start {
+			t.Fatalf("offset %d is at %d:%d, want %d:%d", end, gotLine, gotCol, line, end-start)
+		}
+		if table.LineStart(line) != start || table.LineEnd(line) != end {
+			t.Fatalf("line %d is %d-%d, want %d-%d", line, table.LineStart(line), table.LineEnd(line), start, end)
+		}
+		if got := table.Line(line); got != want[start:end] {
+			t.Fatalf("line %d is %q, want %q", line, got, want[start:end])
+		}
+	}
+	if table.HasLine(len(starts)) {
+		t.Fatalf("the table has a line %d past the end", len(starts))
+	}
+}
+
+// looking up the line of one offset, which only indexes the text up to it.
+// Position would index the rest too, LineStart reads a whole chunk.
+func checkLineAt(t *testing.T, table *PieceTable, want string, offset int) {
+	t.Helper()
+	if got, want := table.lineAt(offset), strings.Count(want[:offset], "\n"); got != want {
+		t.Fatalf("offset %d is on line %d, want %d", offset, got, want)
+	}
+	if table.scanned > len(want) {
+		t.Fatalf("the index has looked at %d bytes of %d", table.scanned, len(want))
+	}
+}
+
+func TestPieceTableRandomEdits(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		want := randomText(r, r.Intn(200))
+		table := NewPieceTable([]byte(want))
+		type snapshot struct {
+			table *PieceTable
+			text  string
+		}
+		var snapshots []snapshot
+		for step := 0; step < 300; step++ {
+			switch r.Intn(10) {
+			case 0, 1, 2, 3:
+				offset := r.Intn(len(want) + 1)
+				text := randomText(r, r.Intn(12))
+				table.Insert(offset, text)
+				want = want[:offset] + text + want[offset:]
+			case 4, 5, 6:
+				offset := r.Intn(len(want) + 1)
+				length := r.Intn(len(want) - offset + 1)
+				table.Delete(offset, length)
+				want = want[:offset] + want[offset+length:]
+			case 7:
+				// the index is left covering only part of the text for the next edit
+				checkLineAt(t, table, want, r.Intn(len(want)+1))
+			case 8:
+				start := r.Intn(len(want) + 1)
+				end := start + r.Intn(len(want)-start+1)
+				if got := table.Slice(start, end); got != want[start:end] {
+					t.Fatalf("seed %d: slice %d-%d is %q, want %q", seed, start, end, got, want[start:end])
+				}
+			case 9:
+				snapshots = append(snapshots, snapshot{table.Snapshot(), want})
+			}
+			if step%50 == 49 {
+				checkTable(t, table, want)
+				// and the index is thrown away to be built lazily again
+				table.lines = nil
+			}
+		}
+		checkTable(t, table, want)
+		for _, s := range snapshots {
+			checkTable(t, s.table, s.text)
+		}
+	}
+}
+
+func TestSnapshotIsUnchangedByEdits(t *testing.T) {
+	table := NewPieceTable([]byte("one\ntwo\n"))
+	// room to grow, so both tables would append to the same array
+	table.added = make([]byte, 0, 64)
+	table.Insert(4, "and ")
+	snap := table.Snapshot()
+	table.Insert(8, "then ")
+	table.Delete(0, 4)
+	checkTable(t, snap, "one\nand two\n")
+	snap.Insert(0, "zero\n")
+	checkTable(t, snap, "zero\none\nand two\n")
+	checkTable(t, table, "and then two\n")
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// slik can read what is piped into it with `slik -`, and in filter mode
+// (`slik -filter`) the buffer is written to stdout when the editor quits, so
+// `cmd | slik -filter | other` lets the text be edited on its way through a
+// pipeline. termbox talks to the terminal itself, so stdin and stdout are free.
+
+// whether stdin is the terminal rather than a pipe or a file, reading it would wait
+// for the user to type the text and press Ctrl+D
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// reading everything piped into stdin, this has to happen before termbox takes over the terminal
+func readStdin() ([]byte, error) {
+	return io.ReadAll(os.Stdin)
+}
+
+// putting text that was piped in into a scratch buffer that has no file name yet
+func (e *Editor) OpenStdin(data []byte) {
+	text, format := decodeFile(data)
+	e.format = format
+	e.savedFormat = format
+	e.writeEditor(text)
+	filename = ""
+	if e.filter {
+		e.message = "filter mode: the buffer is written to stdout when you quit"
+	} else {
+		e.message = "read from stdin, Ctrl+O saves it to a file"
+	}
+}
+
+// asking whether the buffer should go to stdout when quitting in filter mode,
+// it returns false if the editor should stay open
+func (e *Editor) confirmFilter() bool {
+	switch e.Ask("write the buffer to stdout? (y)es (n)o (c)ancel", "ync") {
+	case 'y':
+		e.filterWrite = true
+		return true
+	case 'n':
+		return true
+	}
+	return false
+}
+
+// writing the buffer to stdout once the terminal is handed back, the result is the exit status
+func (e *Editor) finishFilter() int {
+	if !e.filterWrite {
+		// whatever is reading the pipe can tell the edit was thrown away
+		return 1
+	}
+	if _, err := os.Stdout.Write(encodeFile(e.buffer.String(), e.format)); err != nil {
+		os.Stderr.WriteString("slik: writing to stdout: " + err.Error() + "\n")
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nsf/termbox-go"
+)
+
+// asking for a line of text on the stat bar, it returns false if Esc was pressed
+func (e *Editor) Prompt(label string) (string, bool) {
+	return e.prompt(label, "", nil, false)
+}
+
+// asking for a passphrase, what is typed is shown as stars
+func (e *Editor) PromptPassword(label string) (string, bool) {
+	return e.prompt(label, "", nil, true)
+}
+
+// asking for a file name, Tab completes the names of files and directories
+func (e *Editor) PromptFile(label, initial string) (string, bool) {
+	return e.prompt(label, initial, completePath, false)
+}
+
+// the line editor behind the prompts, complete is called with the input when Tab is pressed
+func (e *Editor) prompt(label, input string, complete func(string) string, masked bool) (string, bool) {
+	for {
+		e.Render()
+		if masked {
+			e.drawPrompt(label + strings.Repeat("*", clusterCount(input)))
+		} else {
+			e.drawPrompt(label + input)
+		}
+		switch ev := pollEvent(); ev.Type {
+		case termbox.EventKey:
+			switch ev.Key {
+			case termbox.KeyEsc:
+				return "", false
+			case termbox.KeyEnter:
+				return input, true
+			case termbox.KeyBackspace, termbox.KeyBackspace2:
+				input = input[:prevBoundary(input, len(input))]
+			case termbox.KeySpace:
+				input += " "
+			case termbox.KeyTab:
+				if complete != nil {
+					input = complete(input)
+				}
+			default:
+				if ev.Ch != 0 {
+					input += string(ev.Ch)
+				}
+			}
+		case termbox.EventError:
+			return "", false
+		}
+	}
+}
+
+// completing the last part of a path as far as the names in its directory agree,
+// a directory that is completed fully gets a separator so the next Tab looks inside it
+func completePath(input string) string {
+	dir, prefix := filepath.Split(input)
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	}
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return input
+	}
+	var matches []os.DirEntry
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), prefix) {
+			matches = append(matches, entry)
+		}
+	}
+	if len(matches) == 0 {
+		return input
+	}
+	if len(matches) == 1 {
+		completed := dir + matches[0].Name()
+		if matches[0].IsDir() {
+			completed += string(filepath.Separator)
+		}
+		return completed
+	}
+	common := matches[0].Name()
+	for _, entry := range matches[1:] {
+		for !strings.HasPrefix(entry.Name(), common) {
+			common = common[:len(common)-1]
+		}
+	}
+	// don't stop in the middle of a character
+	for !utf8.ValidString(common) {
+		common = common[:len(common)-1]
+	}
+	return dir + common
+}
+
+// asking a question on the stat bar that is answered by pressing one of the keys in answers,
+// the answer is returned in lower case and Esc gives 0
+func (e *Editor) Ask(question string, answers string) rune {
+	for {
+		e.Render()
+		e.drawPrompt(question + " ")
+		switch ev := pollEvent(); ev.Type {
+		case termbox.EventKey:
+			if ev.Key == termbox.KeyEsc {
+				return 0
+			}
+			answer := unicode.ToLower(ev.Ch)
+			if answer != 0 && strings.ContainsRune(answers, answer) {
+				return answer
+			}
+		case termbox.EventError:
+			return 0
+		}
+	}
+}
+
+// drawing text over the stat bar with the cursor after it
+func (e *Editor) drawPrompt(text string) {
+	for j := 0; j < e.width; j++ {
+		termbox.SetCell(j, e.height, ' ', termbox.ColorBlack, termbox.ColorWhite)
+	}
+	end := drawString(0, e.height, e.width, text, termbox.ColorBlack, termbox.ColorWhite)
+	termbox.SetCursor(end, e.height)
+	termbox.Flush()
+}
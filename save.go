@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// writing data to path so that the file is either fully written or left as it was.
+// The data goes to a temporary file next to the target which is synced and then
+// renamed over it, keeping the mode and owner of the file that was there before.
+// New files are created with perm less the umask.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	return writeFileFrom(path, perm, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}, nil)
+}
+
+// returned when the file can't be replaced by a new one, the only way left to save
+// is overwriting it where it is, which a full disk or a crash leaves half written
+type inPlaceError struct {
+	err error
+}
+
+func (e *inPlaceError) Error() string {
+	return e.err.Error()
+}
+
+func (e *inPlaceError) Unwrap() error {
+	return e.err
+}
+
+// writeFileAtomic for text that is produced by write instead of held in memory.
+// ready, if it isn't nil, is given the finished temporary file just before it is
+// renamed over path.
+func writeFileFrom(path string, perm os.FileMode, write func(io.Writer) error, ready func(tmp string) error) error {
+	// replace the file a symlink points at rather than the link itself
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	mode := perm &^ umask()
+	info, err := os.Stat(path)
+	if err == nil {
+		mode = info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		if info != nil {
+			return &inPlaceError{fmt.Errorf("cannot write a temporary file next to it: %v", err)}
+		}
+		return err
+	}
+	tmpName := tmp.Name()
+	err = writeAndSync(tmp, write)
+	if err == nil {
+		err = os.Chmod(tmpName, mode)
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if info != nil {
+		if err := keepOwner(tmpName, info); err != nil {
+			// only the owner of the file can give it away
+			os.Remove(tmpName)
+			return &inPlaceError{fmt.Errorf("cannot keep the owner of the file: %v", err)}
+		}
+	}
+	if ready != nil {
+		if err := ready(tmpName); err != nil {
+			os.Remove(tmpName)
+			return err
+		}
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// overwriting a file without replacing it, only done when the user agreed to it after
+// an inPlaceError. The file is half written if this fails on the way.
+func writeFileInPlace(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	return writeAndSync(file, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// writing to a file and making sure it reached the disk before closing it
+func writeAndSync(file *os.File, write func(io.Writer) error) error {
+	w := bufio.NewWriter(file)
+	err := write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestNewFileKeepsTheUmask(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "new.txt")
+	if err := writeFileAtomic(path, []byte("text"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 0666 &^ umask(); info.Mode().Perm() != want {
+		t.Errorf("the new file has mode %v, want %v", info.Mode().Perm(), want)
+	}
+}
+
+func TestNoTemporaryFileLeavesTheFileAlone(t *testing.T) {
+	if os.Geteuid() == 0 || runtime.GOOS == "windows" {
+		t.Skip("the directory can be written to anyway")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(path, []byte("old text"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0755) })
+	err := writeFileAtomic(path, []byte("new text"), 0644)
+	var inPlace *inPlaceError
+	if !errors.As(err, &inPlace) {
+		t.Fatalf("got %v, want an inPlaceError", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "old text" {
+		t.Errorf("the file holds %q", data)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The text of a buffer with unsaved changes is written to a swap file every few
+// seconds, so a crash loses at most the last few edits. The swap file sits next
+// to the file as .name.slik.swp, or in the state directory when that isn't
+// possible, and is removed when the editor quits normally. The name is slik's
+// own so the swap files of Vim are never written over or removed. A buffer
+// without a file is journaled in the state directory under the process id.
+
+// the first line of a swap file, the text of the buffer follows it
+type swapHeader struct {
+	Path   string     `json:"path"`
+	PID    int        `json:"pid"`
+	Time   time.Time  `json:"time"`
+	Format FileFormat `json:"format"`
+}
+
+// where slik keeps files that are not part of any project
+func stateDir() (string, error) {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	dir = filepath.Join(dir, "slik")
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+// the end of the name of every swap file
+const swapSuffix = ".slik.swp"
+
+// the start of the name of the swap files of buffers without a file
+const unnamedSwap = "unnamed-"
+
+// the places a swap file for name can be, next to it first and then in the state
+// directory. A buffer without a name only has one, for this process.
+func swapPaths(name string) []string {
+	var paths []string
+	if name == "" {
+		if dir, err := stateDir(); err == nil {
+			paths = append(paths, filepath.Join(dir, "swap", unnamedSwap+strconv.Itoa(os.Getpid())+swapSuffix))
+		}
+		return paths
+	}
+	path, err := filepath.Abs(name)
+	if err != nil {
+		return nil
+	}
+	paths = append(paths, filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+swapSuffix))
+	if dir, err := stateDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "swap", escapePath(path)+swapSuffix))
+	}
+	return paths
+}
+
+// turning an absolute path into a file name, the whole path goes into the name
+// so files with the same name in different directories don't share one. The
+// escapes are those of URLs, so no two paths end up with the same name.
+var pathEscaper = strings.NewReplacer("%", "%25", "/", "%2F", "\\", "%5C", ":", "%3A")
+
+func escapePath(path string) string {
+	return pathEscaper.Replace(path)
+}
+
+// writing the buffer to its swap file if it changed and the last write was long enough ago
+func (e *Editor) journal() {
+	if !settings.Swap || e.noSwap || e.stateID() == e.swapID {
+		return
+	}
+	if time.Since(e.swapTime) < time.Duration(settings.SwapInterval)*time.Second {
+		return
+	}
+	e.writeSwap()
+}
+
+// writing the buffer to its swap file now
+func (e *Editor) writeSwap() {
+	if !settings.Swap || e.noSwap {
+		return
+	}
+	path := ""
+	if filename != "" {
+		path, _ = filepath.Abs(filename)
+	}
+	header, err := json.Marshal(swapHeader{Path: path, PID: os.Getpid(), Time: time.Now(), Format: e.format})
+	if err != nil {
+		return
+	}
+	data := append(append(header, '\n'), e.buffer.String()...)
+	for _, swap := range swapPaths(filename) {
+		os.MkdirAll(filepath.Dir(swap), 0700)
+		if writeFileAtomic(swap, data, 0600) == nil {
+			// the file was saved under another name since the last swap file was written
+			if e.swapFile != "" && e.swapFile != swap {
+				os.Remove(e.swapFile)
+			}
+			e.swapFile = swap
+			e.swapID = e.stateID()
+			e.swapTime = time.Now()
+			return
+		}
+	}
+}
+
+// removing the swap file once the changes in it are no longer needed
+func (e *Editor) removeSwap() {
+	if e.swapFile != "" {
+		os.Remove(e.swapFile)
+		e.swapFile = ""
+	}
+}
+
+// reading a swap file back into its header and text
+func readSwap(path string) (swapHeader, string, error) {
+	var header swapHeader
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return header, "", err
+	}
+	end := bytes.IndexByte(data, '\n')
+	if end == -1 {
+		return header, "", errors.New("not a swap file")
+	}
+	if err := json.Unmarshal(data[:end], &header); err != nil {
+		return header, "", err
+	}
+	return header, string(data[end+1:]), nil
+}
+
+// the swap files of buffers without a file left behind by slik processes that are gone
+func orphanedSwaps() []string {
+	dir, err := stateDir()
+	if err != nil {
+		return nil
+	}
+	swaps, _ := filepath.Glob(filepath.Join(dir, "swap", unnamedSwap+"*"+swapSuffix))
+	var orphaned []string
+	for _, swap := range swaps {
+		header, _, err := readSwap(swap)
+		if err == nil && header.Path == "" && header.PID != os.Getpid() && !processAlive(header.PID) {
+			orphaned = append(orphaned, swap)
+		}
+	}
+	return orphaned
+}
+
+// looking for a swap file left behind for the open file and asking what to do with
+// it. For a buffer without a file it looks for one left by a slik that crashed.
+func (e *Editor) checkSwap() {
+	if !settings.Swap {
+		return
+	}
+	path, swaps, name := "", orphanedSwaps(), "[no name]"
+	if filename != "" {
+		path, _ = filepath.Abs(filename)
+		swaps, name = swapPaths(filename), filename
+	}
+	for _, swap := range swaps {
+		header, text, err := readSwap(swap)
+		if err != nil || header.Path != path {
+			continue
+		}
+		if e.format.Encrypted {
+			// plain text left from before the file was encrypted must not stay on disk
+			os.Remove(swap)
+			continue
+		}
+		if e.noSwap {
+			continue
+		}
+		if text == e.buffer.String() {
+			// nothing in it that isn't in the file already
+			os.Remove(swap)
+			continue
+		}
+		question := "found a swap file from " + header.Time.Format("2006-01-02 15:04")
+		if header.PID != os.Getpid() && processAlive(header.PID) {
+			question += fmt.Sprintf(" (slik %d still has it open)", header.PID)
+		}
+		question += ": (r)ecover (v)iew diff (d)elete, Esc to keep it"
+		for {
+			switch e.Ask(question, "rvd") {
+			case 'r':
+				// the recovered text counts as unsaved until it is written to the file
+				e.buffer = NewPieceTable([]byte(text))
+				e.format = header.Format
+				// the history is of the file, not of the recovered text
+				e.resetUndo()
+				e.savedID = -1
+				e.swapID = -1
+				e.setCursor(0, 0)
+				e.message = "recovered " + swap
+				os.Remove(swap)
+				return
+			case 'v':
+				e.ShowText("changes in the swap file", unifiedDiff(name, swap, e.buffer.String(), text))
+				continue
+			case 'd':
+				os.Remove(swap)
+				return
+			default:
+				e.message = "kept " + swap
+				if filename != "" {
+					// writing our own swap file would replace the one that was left alone
+					e.noSwap = true
+					e.message += ", changes are not being journaled"
+				}
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSwapPathsAreSliksOwn(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+	paths := swapPaths(filepath.Join(dir, "notes.txt"))
+	if len(paths) != 2 {
+		t.Fatalf("got %d swap paths, want 2", len(paths))
+	}
+	if want := filepath.Join(dir, ".notes.txt.slik.swp"); paths[0] != want {
+		t.Errorf("the swap file next to the file is %s, want %s", paths[0], want)
+	}
+	for _, path := range paths {
+		if strings.HasSuffix(path, ".txt.swp") {
+			t.Errorf("%s is the name Vim uses", path)
+		}
+	}
+}
+
+func TestUnnamedBufferIsJournaled(t *testing.T) {
+	state := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", state)
+	old := filename
+	filename = ""
+	t.Cleanup(func() { filename = old })
+
+	e := testEditor("")
+	e.insert("typed before a crash")
+	e.writeSwap()
+	if e.swapFile == "" || !strings.HasPrefix(e.swapFile, state) {
+		t.Fatalf("the unnamed buffer was journaled to %q", e.swapFile)
+	}
+	header, text, err := readSwap(e.swapFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Path != "" || text != "typed before a crash" {
+		t.Errorf("the swap file has path %q and text %q", header.Path, text)
+	}
+	// a running slik's swap file is never offered to another one
+	if orphaned := orphanedSwaps(); len(orphaned) != 0 {
+		t.Errorf("the swap file of this process counts as left behind: %v", orphaned)
+	}
+	swap := e.swapFile
+	e.removeSwap()
+	if _, err := os.Stat(swap); !os.IsNotExist(err) {
+		t.Errorf("%s is still there after quitting", swap)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Transforms tidy the text of a buffer just before it is saved. Which ones run
+// is set with "onSave" in config.json, for all files or per file type, and
+// they run in the order they are listed. Whatever they change is recorded as a
+// single action, so one undo puts the text back the way it was typed.
+
+// a transform takes the whole text of the buffer and returns the tidied text
+type saveTransform func(text string) string
+
+var saveTransforms = map[string]saveTransform{
+	"trimTrailingWhitespace": trimTrailingWhitespace,
+	"finalNewline":           finalNewline,
+	"trimTrailingLines":      trimTrailingLines,
+	"normalizeLineEndings":   normalizeLineEndings,
+}
+
+// removing spaces and tabs from the ends of lines
+func trimTrailingWhitespace(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// making sure a text that isn't empty ends with a newline
+func finalNewline(text string) string {
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		return text + "\n"
+	}
+	return text
+}
+
+// collapsing the blank lines at the end of the text, the last line keeps its newline
+func trimTrailingLines(text string) string {
+	trimmed := strings.TrimRight(text, "\n")
+	if len(trimmed) < len(text) {
+		return trimmed + "\n"
+	}
+	return text
+}
+
+// turning the line breaks that are left over from a file with mixed line endings into
+// plain newlines, the line ending the file is saved with is chosen by its format
+func normalizeLineEndings(text string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\r", "\n")
+}
+
+// the transforms that run when the open file is saved
+func onSave() []string {
+	if ft, ok := settings.FileTypes[fileType(filename)]; ok && ft.OnSave != nil {
+		return ft.OnSave
+	}
+	return settings.OnSave
+}
+
+// running the transforms for the open file over the buffer before it is saved
+func (e *Editor) applyTransforms() error {
+	names := onSave()
+	if len(names) == 0 || e.largeFile || e.hex != nil {
+		return nil
+	}
+	old := e.buffer.String()
+	text := old
+	for _, name := range names {
+		transform, ok := saveTransforms[name]
+		if !ok {
+			return fmt.Errorf("unknown onSave transform %q", name)
+		}
+		text = transform(text)
+	}
+	if text == old {
+		return nil
+	}
+	format := e.format
+	if format.Mixed && !strings.Contains(text, "\r") {
+		// normalizeLineEndings left only one kind
+		format.Mixed = false
+	}
+	e.editFormat(format, func() { e.editAll(text) })
+	return nil
+}
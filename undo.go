@@ -0,0 +1,318 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Every change to the buffer goes through edit, which records it as an Action
+// holding the byte range it replaced and what it replaced it with. Undo and Redo
+// apply those in reverse and forward, so they never have to know what kind of
+// key made the change.
+//
+// Actions are undone in groups. Characters typed one after another join the
+// same group until a new word starts or the typing stops for a moment, and a
+// command that makes several edits wraps them in beginGroup and endGroup so
+// that one undo takes all of them back.
+
+// how long typing can pause and still be undone together with what came before
+const undoIdle = time.Second
+
+// replacing length bytes at offset with text, recording it so it can be undone.
+// The cursor ends up after the new text.
+func (e *Editor) edit(offset, length int, text string) {
+	removed := e.buffer.Slice(offset, offset+length)
+	if removed == "" && text == "" {
+		return
+	}
+	y, x := e.cursorY+e.offsetY, e.cursorX+e.offsetX
+	e.buffer.Delete(offset, length)
+	e.buffer.Insert(offset, text)
+	if e.hex == nil {
+		e.setCursor(e.buffer.Position(offset + len(text)))
+	}
+	e.addUndo(Action{
+		Offset:     offset,
+		Removed:    removed,
+		Inserted:   text,
+		CursorX:    x,
+		CursorY:    y,
+		CursorXEND: e.cursorX + e.offsetX,
+		CursorYEND: e.cursorY + e.offsetY,
+		Time:       time.Now(),
+	})
+}
+
+// recording an edit so it can be undone, every edit gets a new id. What was
+// undone before it stays in the history as another branch, Redo follows the new one.
+func (e *Editor) addUndo(action Action) {
+	e.lastActionID++
+	action.id = e.lastActionID
+	action.parent = e.stateID()
+	action.group = action.id
+	switch {
+	case e.groupDepth > 0 && e.openGroup != 0:
+		action.group = e.openGroup
+	case e.groupDepth == 0 && len(e.RedoBuffer) == 0 && len(e.UndoBuffer) > 0 && e.continuesTyping(e.UndoBuffer[len(e.UndoBuffer)-1], action):
+		// typing after an undo starts a new branch, so it never joins what came before
+		action.group = e.UndoBuffer[len(e.UndoBuffer)-1].group
+	}
+	if e.groupDepth > 0 {
+		e.openGroup = action.group
+	}
+	e.UndoBuffer = append(e.UndoBuffer, action)
+	e.RedoBuffer = e.RedoBuffer[:0]
+	e.history = append(e.history, action)
+}
+
+// forgetting the history, the buffer as it is now becomes the saved state
+func (e *Editor) resetUndo() {
+	e.UndoBuffer = []Action{}
+	e.RedoBuffer = []Action{}
+	e.history = nil
+	e.savedID = e.stateID()
+}
+
+// whether action is the next character typed right after last, in the same word
+// and without a pause or a save in between
+func (e *Editor) continuesTyping(last, action Action) bool {
+	if !typed(last) || !typed(action) || last.id == e.savedID {
+		return false
+	}
+	if action.Offset != last.Offset+len(last.Inserted) || action.Time.Sub(last.Time) > undoIdle {
+		return false
+	}
+	// a word starts a new group, the spaces and punctuation after it stay with it
+	prev, _ := utf8.DecodeLastRuneInString(last.Inserted)
+	next, _ := utf8.DecodeRuneInString(action.Inserted)
+	return !isWordChar(next) || isWordChar(prev)
+}
+
+// whether an action is a single character typed without removing anything
+func typed(action Action) bool {
+	return action.Removed == "" && action.Inserted != "\n" && utf8.RuneCountInString(action.Inserted) == 1
+}
+
+func isWordChar(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// starting a group of edits that are undone as one, until the matching endGroup.
+// Groups can be nested, the outermost one decides where the group ends.
+func (e *Editor) beginGroup() {
+	if e.groupDepth == 0 {
+		e.openGroup = 0
+	}
+	e.groupDepth++
+}
+
+// ending the group started by beginGroup
+func (e *Editor) endGroup() {
+	if e.groupDepth > 0 {
+		e.groupDepth--
+	}
+}
+
+// the id of the state the buffer is in, undoing and redoing returns to earlier ids
+func (e *Editor) stateID() int {
+	if len(e.UndoBuffer) == 0 {
+		return 0
+	}
+	return e.UndoBuffer[len(e.UndoBuffer)-1].id
+}
+
+// taking back the last group of edits
+func (e *Editor) Undo() {
+	if len(e.UndoBuffer) == 0 || e.refuseEdit() {
+		return
+	}
+	group := e.UndoBuffer[len(e.UndoBuffer)-1].group
+	var action Action
+	for len(e.UndoBuffer) > 0 && e.UndoBuffer[len(e.UndoBuffer)-1].group == group {
+		action = e.UndoBuffer[len(e.UndoBuffer)-1]
+		e.UndoBuffer = e.UndoBuffer[:len(e.UndoBuffer)-1]
+		e.undoAction(action)
+		e.RedoBuffer = append(e.RedoBuffer, action)
+	}
+	// the first action of the group knows where the cursor was before it
+	e.placeCursor(action.Offset, action.CursorY, action.CursorX)
+}
+
+// doing the last undone group of edits again
+func (e *Editor) Redo() {
+	if len(e.RedoBuffer) == 0 || e.refuseEdit() {
+		return
+	}
+	group := e.RedoBuffer[len(e.RedoBuffer)-1].group
+	var action Action
+	for len(e.RedoBuffer) > 0 && e.RedoBuffer[len(e.RedoBuffer)-1].group == group {
+		action = e.RedoBuffer[len(e.RedoBuffer)-1]
+		e.RedoBuffer = e.RedoBuffer[:len(e.RedoBuffer)-1]
+		e.redoAction(action)
+		e.UndoBuffer = append(e.UndoBuffer, action)
+	}
+	e.placeCursor(action.Offset+len(action.Inserted), action.CursorYEND, action.CursorXEND)
+}
+
+// putting back what an action replaced, and the format if it changed it
+func (e *Editor) undoAction(action Action) {
+	e.buffer.Delete(action.Offset, len(action.Inserted))
+	e.buffer.Insert(action.Offset, action.Removed)
+	if action.FormatBefore != nil {
+		e.setTextFormat(*action.FormatBefore)
+	}
+}
+
+// making an action's edit again, and its change to the format
+func (e *Editor) redoAction(action Action) {
+	e.buffer.Delete(action.Offset, len(action.Removed))
+	e.buffer.Insert(action.Offset, action.Inserted)
+	if action.FormatAfter != nil {
+		e.setTextFormat(*action.FormatAfter)
+	}
+}
+
+// taking the line endings and encoding of format. Compression and encryption
+// go by the file and stay as they are.
+func (e *Editor) setTextFormat(format FileFormat) {
+	format.Compression, format.Encrypted = e.format.Compression, e.format.Encrypted
+	e.format = format
+}
+
+// making the edits of edit and then giving the text format, as one change
+// that undo takes back along with the format the text had before
+func (e *Editor) editFormat(format FileFormat, edit func()) {
+	before, id := e.format, e.stateID()
+	edit()
+	e.setTextFormat(format)
+	if e.stateID() == id {
+		// the text was already right, only the format changed
+		return
+	}
+	after := e.format
+	// the action was just added, it is last in both
+	e.UndoBuffer[len(e.UndoBuffer)-1].FormatBefore = &before
+	e.UndoBuffer[len(e.UndoBuffer)-1].FormatAfter = &after
+	e.history[len(e.history)-1].FormatBefore = &before
+	e.history[len(e.history)-1].FormatAfter = &after
+}
+
+// putting the cursor back where an action left it, the hex view goes by offset
+func (e *Editor) placeCursor(offset, line, col int) {
+	if e.hex != nil {
+		e.hexMove(offset)
+		return
+	}
+	// the text may be shorter than when the position was recorded, stay inside it
+	if !e.buffer.HasLine(line) {
+		line = e.buffer.LineCount() - 1
+	}
+	e.setCursor(line, min(col, e.buffer.LineLen(line)))
+}
+
+// replacing the whole text of the buffer with text as one action, only the part
+// between what stayed the same at both ends goes into it. The cursor stays where
+// it was unless its line got shorter or went away.
+func (e *Editor) editAll(text string) {
+	old := e.buffer.String()
+	start := 0
+	for start < len(old) && start < len(text) && old[start] == text[start] {
+		start++
+	}
+	end := 0
+	for end < len(old)-start && end < len(text)-start && old[len(old)-1-end] == text[len(text)-1-end] {
+		end++
+	}
+	line, col := e.cursorY+e.offsetY, e.cursorX+e.offsetX
+	e.edit(start, len(old)-end-start, text[start:len(text)-end])
+	e.placeCursor(0, line, col)
+}
+
+// the offset of the cursor in the buffer
+func (e *Editor) cursorOffset() int {
+	return e.buffer.Offset(e.cursorY+e.offsetY, e.cursorX+e.offsetX)
+}
+
+// typing text at the cursor
+func (e *Editor) insert(text string) {
+	if e.refuseEdit() {
+		return
+	}
+	e.edit(e.cursorOffset(), 0, text)
+}
+
+// pasting text at the cursor, line breaks from other systems become newlines
+func (e *Editor) Paste(text string) {
+	if text == "" {
+		return
+	}
+	e.insert(normalizeLineEndings(text))
+}
+
+// removing the character before the cursor, or joining the line to the one above
+func (e *Editor) Backspace() {
+	if e.refuseEdit() {
+		return
+	}
+	lineIndex, col := e.cursorY+e.offsetY, e.cursorX+e.offsetX
+	switch {
+	case col > 0:
+		// remove the whole character before the cursor, not just its last byte
+		start := prevBoundary(e.buffer.Line(lineIndex), col)
+		e.edit(e.buffer.Offset(lineIndex, start), col-start, "")
+	case lineIndex > 0:
+		// remove the newline at the end of the previous line to join them
+		e.edit(e.buffer.LineEnd(lineIndex-1), 1, "")
+	}
+}
+
+// removing the character under the cursor, or joining the next line to this one
+func (e *Editor) DeleteChar() {
+	if e.refuseEdit() {
+		return
+	}
+	lineIndex, col := e.cursorY+e.offsetY, e.cursorX+e.offsetX
+	line := e.buffer.Line(lineIndex)
+	switch {
+	case col < len(line):
+		e.edit(e.buffer.Offset(lineIndex, col), nextBoundary(line, col)-col, "")
+	case e.buffer.HasLine(lineIndex + 1):
+		e.edit(e.buffer.LineEnd(lineIndex), 1, "")
+	}
+}
+
+// indenting at the cursor, with either a real tab or the spaces up to the next
+// tab stop depending on the file type
+func (e *Editor) Tab() {
+	indent := "\t"
+	if e.expandTab() {
+		line := e.buffer.Line(e.cursorY + e.offsetY)
+		width := displayWidth(line[:e.cursorX+e.offsetX], e.tabWidth())
+		indent = strings.Repeat(" ", e.tabWidth()-width%e.tabWidth())
+	}
+	e.insert(indent)
+}
+
+// replacing every place old is found with text, one undo takes all of them back
+func (e *Editor) replaceAll(old, text string) {
+	if old == "" || e.refuseEdit() {
+		return
+	}
+	line, col := e.cursorY+e.offsetY, e.cursorX+e.offsetX
+	count := 0
+	e.beginGroup()
+	for found := e.buffer.Index(old, 0); found != -1; found = e.buffer.Index(old, found+len(text)) {
+		e.edit(found, len(old), text)
+		count++
+	}
+	e.endGroup()
+	if count == 0 {
+		e.message = "not found: " + old
+		return
+	}
+	e.placeCursor(0, line, col)
+	e.message = "replaced " + strconv.Itoa(count) + " times: " + old
+}
@@ -0,0 +1,333 @@
+package main
+
+import "testing"
+
+// an editor on text with a screen big enough that nothing scrolls
+func testEditor(text string) *Editor {
+	return &Editor{
+		buffer: NewPieceTable([]byte(text)),
+		width:  80,
+		height: 24,
+	}
+}
+
+// the text of the buffer after undoing and then redoing everything
+func undoAll(e *Editor) string {
+	for len(e.UndoBuffer) > 0 {
+		e.Undo()
+	}
+	return e.buffer.String()
+}
+
+func redoAll(e *Editor) string {
+	for len(e.RedoBuffer) > 0 {
+		e.Redo()
+	}
+	return e.buffer.String()
+}
+
+func TestUndoAll(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		line  int
+		col   int
+		edits func(e *Editor)
+		want  string
+	}{
+		{
+			name: "typing",
+			text: "hello",
+			col:  5,
+			edits: func(e *Editor) {
+				for _, c := range " world" {
+					e.insert(string(c))
+				}
+			},
+			want: "hello world",
+		},
+		{
+			name:  "enter in the middle of a line",
+			text:  "abcdef",
+			col:   3,
+			edits: func(e *Editor) { e.insert("\n") },
+			want:  "abc\ndef",
+		},
+		{
+			name:  "multi-line paste",
+			text:  "start end",
+			col:   6,
+			edits: func(e *Editor) { e.Paste("one\r\ntwo\nthree ") },
+			want:  "start one\ntwo\nthree end",
+		},
+		{
+			name: "backspace joining lines",
+			text: "one\ntwo",
+			line: 1,
+			edits: func(e *Editor) {
+				e.Backspace()
+				e.Backspace()
+			},
+			want: "ontwo",
+		},
+		{
+			name:  "backspace over a wide character",
+			text:  "aé",
+			col:   3,
+			edits: func(e *Editor) { e.Backspace() },
+			want:  "a",
+		},
+		{
+			name: "delete at the end of a line",
+			text: "one\ntwo\n",
+			col:  3,
+			edits: func(e *Editor) {
+				e.DeleteChar()
+				e.DeleteChar()
+			},
+			want: "onewo\n",
+		},
+		{
+			name: "delete at the end of the text",
+			text: "one",
+			col:  3,
+			edits: func(e *Editor) {
+				e.DeleteChar()
+			},
+			want: "one",
+		},
+		{
+			name: "tab to the next stop",
+			text: "ab",
+			col:  2,
+			edits: func(e *Editor) {
+				e.Tab()
+				e.insert("c")
+			},
+			want: "ab  c",
+		},
+		{
+			name: "replacing a range",
+			text: "keep this, drop that",
+			edits: func(e *Editor) {
+				e.edit(11, 4, "swap")
+				e.edit(0, 4, "")
+			},
+			want: " this, swap that",
+		},
+		{
+			name: "mixed edits across lines",
+			text: "first\nsecond\nthird",
+			line: 1,
+			col:  6,
+			edits: func(e *Editor) {
+				e.Paste("\nnew\n")
+				e.Backspace()
+				e.DeleteChar()
+				e.Tab()
+				e.setCursor(0, 0)
+				e.DeleteChar()
+			},
+			want: "irst\nsecond\nnew third",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := testEditor(test.text)
+			e.setCursor(test.line, test.col)
+			test.edits(e)
+			if got := e.buffer.String(); got != test.want {
+				t.Fatalf("after the edits got %q, want %q", got, test.want)
+			}
+			if got := undoAll(e); got != test.text {
+				t.Fatalf("after undoing everything got %q, want %q", got, test.text)
+			}
+			if e.stateID() != 0 {
+				t.Errorf("after undoing everything the state is %d, want 0", e.stateID())
+			}
+			if got := redoAll(e); got != test.want {
+				t.Fatalf("after redoing everything got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestUndoRestoresCursor(t *testing.T) {
+	e := testEditor("one\ntwo")
+	e.setCursor(1, 3)
+	e.Paste(" three\nfour")
+	e.Undo()
+	if line, col := e.cursorY+e.offsetY, e.cursorX+e.offsetX; line != 1 || col != 3 {
+		t.Errorf("undo left the cursor at %d:%d, want 1:3", line, col)
+	}
+	e.Redo()
+	if line, col := e.cursorY+e.offsetY, e.cursorX+e.offsetX; line != 2 || col != 4 {
+		t.Errorf("redo left the cursor at %d:%d, want 2:4", line, col)
+	}
+}
+
+func TestEditClearsRedo(t *testing.T) {
+	e := testEditor("")
+	e.insert("a")
+	e.insert("b")
+	e.Undo()
+	e.insert("c")
+	if len(e.RedoBuffer) != 0 {
+		t.Fatalf("a new edit kept %d actions to redo", len(e.RedoBuffer))
+	}
+	if got := undoAll(e); got != "" {
+		t.Errorf("after undoing everything got %q, want empty", got)
+	}
+}
+
+func TestReadOnlyRefusesUndo(t *testing.T) {
+	e := testEditor("")
+	e.insert("a")
+	e.readOnly = true
+	e.Undo()
+	if got := e.buffer.String(); got != "a" {
+		t.Errorf("undo changed a read-only buffer to %q", got)
+	}
+}
+
+// typing text one character at a time, the way the keys come in
+func typeText(e *Editor, text string) {
+	for _, c := range text {
+		if c == '\n' {
+			e.Enter()
+		} else {
+			e.AppendCharacter(c)
+		}
+	}
+}
+
+func TestUndoGroupsTypingByWord(t *testing.T) {
+	e := testEditor("")
+	typeText(e, "hello, world")
+	want := []string{"hello, ", ""}
+	for _, w := range want {
+		e.Undo()
+		if got := e.buffer.String(); got != w {
+			t.Fatalf("after an undo got %q, want %q", got, w)
+		}
+	}
+	e.Redo()
+	if got := e.buffer.String(); got != "hello, " {
+		t.Fatalf("after a redo got %q, want %q", got, "hello, ")
+	}
+	e.Redo()
+	if got := e.buffer.String(); got != "hello, world" {
+		t.Fatalf("after a redo got %q, want %q", got, "hello, world")
+	}
+}
+
+func TestUndoGroupBreaks(t *testing.T) {
+	tests := []struct {
+		name  string
+		edits func(e *Editor)
+		want  string
+	}{
+		{
+			name: "newline",
+			edits: func(e *Editor) {
+				typeText(e, "ab\ncd")
+			},
+			want: "ab\n",
+		},
+		{
+			name: "pause",
+			edits: func(e *Editor) {
+				typeText(e, "ab")
+				e.UndoBuffer[len(e.UndoBuffer)-1].Time = e.UndoBuffer[len(e.UndoBuffer)-1].Time.Add(-2 * undoIdle)
+				typeText(e, "cd")
+			},
+			want: "ab",
+		},
+		{
+			name: "save",
+			edits: func(e *Editor) {
+				typeText(e, "ab")
+				e.savedID = e.stateID()
+				typeText(e, "cd")
+			},
+			want: "ab",
+		},
+		{
+			name: "moving the cursor",
+			edits: func(e *Editor) {
+				typeText(e, "ab")
+				e.setCursor(0, 0)
+				typeText(e, "cd")
+			},
+			want: "ab",
+		},
+		{
+			name: "backspace",
+			edits: func(e *Editor) {
+				typeText(e, "abc")
+				e.Backspace()
+				typeText(e, "cd")
+			},
+			want: "ab",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := testEditor("")
+			test.edits(e)
+			e.Undo()
+			if got := e.buffer.String(); got != test.want {
+				t.Errorf("after one undo got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestUndoExplicitGroup(t *testing.T) {
+	e := testEditor("one two")
+	e.insert("x")
+	e.beginGroup()
+	e.edit(1, 3, "1")
+	// a group inside another one joins it
+	e.beginGroup()
+	e.edit(3, 3, "2")
+	e.endGroup()
+	e.Paste(" three")
+	e.endGroup()
+	e.insert("y")
+	if got := e.buffer.String(); got != "x1 2 threey" {
+		t.Fatalf("after the edits got %q", got)
+	}
+	for _, want := range []string{"x1 2 three", "xone two", "one two"} {
+		e.Undo()
+		if got := e.buffer.String(); got != want {
+			t.Fatalf("after an undo got %q, want %q", got, want)
+		}
+	}
+	e.Redo()
+	e.Redo()
+	if got := e.buffer.String(); got != "x1 2 three" {
+		t.Errorf("redo didn't keep the group together, got %q", got)
+	}
+}
+
+func TestReplaceAllUndoesAtOnce(t *testing.T) {
+	e := testEditor("a cat, a cat\nand a cat")
+	e.replaceAll("cat", "dog")
+	if got := e.buffer.String(); got != "a dog, a dog\nand a dog" {
+		t.Fatalf("after replacing got %q", got)
+	}
+	e.Undo()
+	if got := e.buffer.String(); got != "a cat, a cat\nand a cat" {
+		t.Fatalf("one undo left %q", got)
+	}
+	e.Redo()
+	if got := e.buffer.String(); got != "a dog, a dog\nand a dog" {
+		t.Fatalf("one redo left %q", got)
+	}
+	// the replacement containing what is replaced doesn't loop
+	e.replaceAll("dog", "dogdog")
+	if got := e.buffer.String(); got != "a dogdog, a dogdog\nand a dogdog" {
+		t.Errorf("after replacing again got %q", got)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The undo history of a file is written to the state directory when the file
+// is saved or closed, along with a hash of the file as it is on disk. When the
+// file is opened again and still has that hash, the history is read back, so
+// Ctrl+Z goes back past the point where slik was started. Encrypted files never
+// have their history written, it holds their text.
+
+// an action as it is written to the undo file
+type savedAction struct {
+	ID, Parent, Group int
+	Offset            int
+	Removed, Inserted string
+	CursorX, CursorY  int
+	CursorXEND        int
+	CursorYEND        int
+	Time              time.Time
+	FormatBefore      *FileFormat `json:",omitempty"`
+	FormatAfter       *FileFormat `json:",omitempty"`
+}
+
+// what is written to the undo file
+type undoFile struct {
+	// the hash of the file on disk the history leads to
+	Hash string
+	// whether the history is of the bytes in the hex view rather than the text
+	Hex bool
+	// the state the file on disk is in, and the one the buffer was in when it was written
+	Saved, Current int
+	Actions        []savedAction
+}
+
+// where the undo history of name is kept
+func undoPath(name string) (string, error) {
+	path, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "undo", escapePath(path)+".json"), nil
+}
+
+// writing the history of the open file to its undo file, or removing the undo
+// file if the history can't be kept
+func (e *Editor) writeUndo() {
+	if !settings.UndoFile || filename == "" {
+		return
+	}
+	path, err := undoPath(filename)
+	if err != nil {
+		return
+	}
+	_, saved := e.action(e.savedID)
+	if e.format.Encrypted || e.largeFile || len(e.history) == 0 || e.disk.hash == [sha256.Size]byte{} || !saved && e.savedID != 0 {
+		// what was kept for an earlier version of the file is no use, and the text of an encrypted one must not be left around
+		os.Remove(path)
+		return
+	}
+	file := undoFile{
+		Hash:    hex.EncodeToString(e.disk.hash[:]),
+		Hex:     e.hex != nil,
+		Saved:   e.savedID,
+		Current: e.stateID(),
+	}
+	for _, action := range e.history {
+		file.Actions = append(file.Actions, savedAction{
+			ID:           action.id,
+			Parent:       action.parent,
+			Group:        action.group,
+			Offset:       action.Offset,
+			Removed:      action.Removed,
+			Inserted:     action.Inserted,
+			CursorX:      action.CursorX,
+			CursorY:      action.CursorY,
+			CursorXEND:   action.CursorXEND,
+			CursorYEND:   action.CursorYEND,
+			Time:         action.Time,
+			FormatBefore: action.FormatBefore,
+			FormatAfter:  action.FormatAfter,
+		})
+	}
+	data, err := json.Marshal(file)
+	if err != nil {
+		return
+	}
+	os.MkdirAll(filepath.Dir(path), 0700)
+	writeFileAtomic(path, data, 0600)
+}
+
+// reading back the history of the file that was just opened, if it was kept
+// for the file as it is on disk now
+func (e *Editor) readUndo() {
+	if !settings.UndoFile || filename == "" || e.largeFile || e.format.Encrypted {
+		return
+	}
+	path, err := undoPath(filename)
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var file undoFile
+	if json.Unmarshal(data, &file) != nil || file.Hash != hex.EncodeToString(e.disk.hash[:]) || file.Hex != (e.hex != nil) {
+		return
+	}
+	history := make([]Action, len(file.Actions))
+	for i, action := range file.Actions {
+		// the ids have to grow and every action has to be made in a state before it
+		if i > 0 && action.ID <= history[i-1].id || action.Parent >= action.ID {
+			return
+		}
+		history[i] = Action{
+			Offset:       action.Offset,
+			Removed:      action.Removed,
+			Inserted:     action.Inserted,
+			CursorX:      action.CursorX,
+			CursorY:      action.CursorY,
+			CursorXEND:   action.CursorXEND,
+			CursorYEND:   action.CursorYEND,
+			Time:         action.Time,
+			FormatBefore: action.FormatBefore,
+			FormatAfter:  action.FormatAfter,
+			id:           action.ID,
+			parent:       action.Parent,
+			group:        action.Group,
+		}
+	}
+	old := e.history
+	e.history = history
+	undo := e.pathTo(file.Saved)
+	whole := len(undo) == 0 && file.Saved == 0 || len(undo) > 0 && undo[0].parent == 0 && undo[len(undo)-1].id == file.Saved
+	if !whole {
+		// the path doesn't run from the text as it was first opened to the saved state
+		e.history = old
+		return
+	}
+	// the history has to lead to the text in the buffer, and every branch of it has
+	// to fit the text it was made in, or undo and redo would edit outside of it
+	root, ok := undoneText(e.buffer.String(), undo)
+	if !ok || !replays(root, e.childActions(), len(history)) {
+		e.history = old
+		return
+	}
+	e.UndoBuffer = undo
+	e.RedoBuffer = e.redoPath(file.Saved, file.Current, e.childActions())
+	e.savedID = file.Saved
+	if len(history) > 0 {
+		e.lastActionID = history[len(history)-1].id
+	}
+}
+
+// undoing the actions of path one after the other on text, each one has to find
+// what it inserted where it says it did. It returns the text before the first one.
+func undoneText(text string, path []Action) (string, bool) {
+	t := NewPieceTable([]byte(text))
+	for i := len(path) - 1; i >= 0; i-- {
+		action := path[i]
+		end := action.Offset + len(action.Inserted)
+		if action.Offset < 0 || end > t.Len() || t.Slice(action.Offset, end) != action.Inserted {
+			return "", false
+		}
+		t.Delete(action.Offset, len(action.Inserted))
+		t.Insert(action.Offset, action.Removed)
+	}
+	return t.String(), true
+}
+
+// whether making every action of the tree in the state it was made in works,
+// starting from text at state 0. Each one has to find what it removed where it
+// says it did, and all count actions have to be reached.
+func replays(text string, children map[int][]Action, count int) bool {
+	t := NewPieceTable([]byte(text))
+	reached := 0
+	var visit func(id int) bool
+	visit = func(id int) bool {
+		for _, action := range children[id] {
+			end := action.Offset + len(action.Removed)
+			if action.Offset < 0 || end > t.Len() || t.Slice(action.Offset, end) != action.Removed {
+				return false
+			}
+			reached++
+			t.Delete(action.Offset, len(action.Removed))
+			t.Insert(action.Offset, action.Inserted)
+			if !visit(action.id) {
+				return false
+			}
+			t.Delete(action.Offset, len(action.Inserted))
+			t.Insert(action.Offset, action.Removed)
+		}
+		return true
+	}
+	return visit(0) && reached == count
+}
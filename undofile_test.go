@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// opening path in a new editor the way the command line does, with the state
+// directory and the open file name kept to the test
+func openTest(t *testing.T, path string) *Editor {
+	t.Helper()
+	e := testEditor("")
+	e.Open(path)
+	if filename != path {
+		t.Fatalf("couldn't open %s: %s", path, e.message)
+	}
+	return e
+}
+
+func setupUndoFile(t *testing.T) string {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	old := filename
+	t.Cleanup(func() { filename = old })
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestUndoFileAcrossSessions(t *testing.T) {
+	path := setupUndoFile(t)
+	e := openTest(t, path)
+	e.setCursor(0, 5)
+	typeText(e, " world")
+	if err := e.SaveFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	e = openTest(t, path)
+	if got := e.buffer.String(); got != "hello world\n" {
+		t.Fatalf("reopened with %q", got)
+	}
+	if e.Modified() {
+		t.Error("the reopened buffer counts as modified")
+	}
+	e.Undo()
+	e.Undo()
+	if got := e.buffer.String(); got != "hello\n" {
+		t.Errorf("undoing in the next session got %q, want %q", got, "hello\n")
+	}
+	// new edits carry on from the old ids
+	e.insert("!")
+	if len(e.history) != 7 || e.stateID() != 7 {
+		t.Errorf("the new edit is action %d of %d, want 7 of 7", e.stateID(), len(e.history))
+	}
+}
+
+func TestUndoFileKeepsUnsavedEditsToRedo(t *testing.T) {
+	path := setupUndoFile(t)
+	e := openTest(t, path)
+	e.setCursor(0, 5)
+	e.Paste(", unsaved")
+	// quitting without saving
+	e.writeUndo()
+
+	e = openTest(t, path)
+	if got := e.buffer.String(); got != "hello\n" {
+		t.Fatalf("reopened with %q", got)
+	}
+	e.Redo()
+	if got := e.buffer.String(); got != "hello, unsaved\n" {
+		t.Errorf("redoing the unsaved edit got %q", got)
+	}
+}
+
+func TestUndoFileIgnoredWhenFileChanged(t *testing.T) {
+	path := setupUndoFile(t)
+	e := openTest(t, path)
+	e.Paste("edited ")
+	if err := e.SaveFile(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("changed by someone else\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	e = openTest(t, path)
+	if len(e.history) != 0 || len(e.UndoBuffer) != 0 {
+		t.Errorf("the history of another version of the file was read back")
+	}
+}
+
+func TestUndoFileNotWrittenWhenEncrypted(t *testing.T) {
+	path := setupUndoFile(t)
+	e := openTest(t, path)
+	e.Paste("secret ")
+	e.writeUndo()
+	undo, err := undoPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(undo); err != nil {
+		t.Fatalf("no undo file was written: %v", err)
+	}
+	e.format.Encrypted = true
+	e.writeUndo()
+	if _, err := os.Stat(undo); !os.IsNotExist(err) {
+		t.Errorf("the undo file of an encrypted buffer was kept")
+	}
+}
+
+func TestUndoFileWithBrokenBranchIsDropped(t *testing.T) {
+	path := setupUndoFile(t)
+	e := openTest(t, path)
+	e.Paste("kept ")
+	e.Undo()
+	e.Paste("saved ")
+	if err := e.SaveFile(); err != nil {
+		t.Fatal(err)
+	}
+	e.Paste("redo ")
+	e.Undo()
+	e.writeUndo()
+	undo, err := undoPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(undo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file undoFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	// every action off the path to the saved state points past the end of the text
+	for i := range file.Actions {
+		if file.Actions[i].ID != file.Saved {
+			file.Actions[i].Offset = 1000
+		}
+	}
+	if data, err = json.Marshal(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(undo, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	e = openTest(t, path)
+	if len(e.history) != 0 {
+		t.Fatalf("the broken history was read back with %d actions", len(e.history))
+	}
+	e.Redo()
+	e.stepState(-1)
+	e.undoTree()
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nsf/termbox-go"
+)
+
+// Undoing and then editing doesn't throw away what was undone, the new edit
+// starts another branch of the history and the old one stays in it, like the
+// undo tree in Vim. Redo follows one branch and the branch command picks which,
+// older and newer step through the states in the order they were made whatever
+// branch they are on, earlier and later do the same by the time they were made,
+// and the undotree command shows the whole tree and previews each state before
+// going to it.
+
+// a state the buffer can be taken back to, the end of a group of actions
+type undoState struct {
+	// the last action of the group, 0 for the text as it was opened
+	id int
+	// the actions that lead to it from the state before, in order
+	actions []Action
+	// the states made from this one, oldest first
+	children []*undoState
+}
+
+// the action with an id in the history
+func (e *Editor) action(id int) (Action, bool) {
+	// ids only grow, so the history is sorted by them
+	i := sort.Search(len(e.history), func(i int) bool { return e.history[i].id >= id })
+	if i < len(e.history) && e.history[i].id == id {
+		return e.history[i], true
+	}
+	return Action{}, false
+}
+
+// the actions that lead from the start of the history to state id, in order
+func (e *Editor) pathTo(id int) []Action {
+	var path []Action
+	for id != 0 {
+		action, ok := e.action(id)
+		if !ok {
+			break
+		}
+		path = append(path, action)
+		id = action.parent
+	}
+	slices.Reverse(path)
+	return path
+}
+
+// the actions made in each state, oldest first
+func (e *Editor) childActions() map[int][]Action {
+	children := map[int][]Action{}
+	for _, action := range e.history {
+		children[action.parent] = append(children[action.parent], action)
+	}
+	return children
+}
+
+// the tree of states, starting from the text as it was opened
+func (e *Editor) undoTree() *undoState {
+	children := e.childActions()
+	root := &undoState{}
+	stack := []*undoState{root}
+	for len(stack) > 0 {
+		state := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		// the branches from this state, and from the middle of its group if one was made there
+		var starts []Action
+		for _, action := range state.actions {
+			for _, child := range children[action.id] {
+				if child.group != action.group {
+					starts = append(starts, child)
+				}
+			}
+		}
+		if len(state.actions) == 0 {
+			starts = children[0]
+		}
+		for _, first := range starts {
+			next := &undoState{id: first.id, actions: []Action{first}}
+			// follow the group to its end
+			for more := true; more; {
+				more = false
+				for _, child := range children[next.id] {
+					if child.group == first.group {
+						next.id = child.id
+						next.actions = append(next.actions, child)
+						more = true
+						break
+					}
+				}
+			}
+			state.children = append(state.children, next)
+			stack = append(stack, next)
+		}
+		sort.Slice(state.children, func(i, j int) bool { return state.children[i].id < state.children[j].id })
+	}
+	return root
+}
+
+// the ids of every state in the order they were made, starting with 0
+func (e *Editor) stateIDs() []int {
+	var ids []int
+	stack := []*undoState{e.undoTree()}
+	for len(stack) > 0 {
+		state := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		ids = append(ids, state.id)
+		stack = append(stack, state.children...)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// taking the buffer to any state in the history, undoing back to where its
+// branch splits off and redoing along it from there
+func (e *Editor) gotoState(target int) {
+	from := e.stateID()
+	path := e.pathTo(target)
+	common := 0
+	for common < len(path) && common < len(e.UndoBuffer) && path[common].id == e.UndoBuffer[common].id {
+		common++
+	}
+	var undone Action
+	for len(e.UndoBuffer) > common {
+		undone = e.UndoBuffer[len(e.UndoBuffer)-1]
+		e.UndoBuffer = e.UndoBuffer[:len(e.UndoBuffer)-1]
+		e.undoAction(undone)
+	}
+	for _, action := range path[common:] {
+		e.redoAction(action)
+	}
+	e.UndoBuffer = path
+	e.RedoBuffer = e.redoPath(target, from, e.childActions())
+	switch {
+	case len(path) > common:
+		last := path[len(path)-1]
+		e.placeCursor(last.Offset+len(last.Inserted), last.CursorYEND, last.CursorXEND)
+	case undone.id != 0:
+		e.placeCursor(undone.Offset, undone.CursorY, undone.CursorX)
+	}
+}
+
+// the actions Redo takes from state id, as a stack with the next one on top.
+// It heads for the state toward where it can, and takes the newest branch elsewhere.
+func (e *Editor) redoPath(id, toward int, children map[int][]Action) []Action {
+	onPath := map[int]bool{}
+	for _, action := range e.pathTo(toward) {
+		onPath[action.id] = true
+	}
+	var path []Action
+	for {
+		kids := children[id]
+		if len(kids) == 0 {
+			break
+		}
+		next := kids[len(kids)-1]
+		for _, kid := range kids {
+			if onPath[kid.id] {
+				next = kid
+			}
+		}
+		path = append(path, next)
+		id = next.id
+	}
+	slices.Reverse(path)
+	return path
+}
+
+// switching the branch Redo follows from the current state to the next one
+func (e *Editor) nextBranch() {
+	children := e.childActions()
+	kids := children[e.stateID()]
+	switch len(kids) {
+	case 0:
+		e.message = "nothing to redo"
+		return
+	case 1:
+		e.message = "there is only one branch to redo"
+		return
+	}
+	current := 0
+	if len(e.RedoBuffer) > 0 {
+		top := e.RedoBuffer[len(e.RedoBuffer)-1]
+		for i, kid := range kids {
+			if kid.id == top.id {
+				current = i
+			}
+		}
+	}
+	next := (current + 1) % len(kids)
+	// the newest state down the chosen branch
+	toward := kids[next].id
+	for len(children[toward]) > 0 {
+		toward = children[toward][len(children[toward])-1].id
+	}
+	e.RedoBuffer = e.redoPath(e.stateID(), toward, children)
+	e.message = fmt.Sprintf("redo follows branch %d of %d", next+1, len(kids))
+}
+
+// going n states back (or forward if n is positive) in the order they were made, whatever branch they are on
+func (e *Editor) stepState(n int) {
+	if e.refuseEdit() {
+		return
+	}
+	ids := e.stateIDs()
+	i := sort.SearchInts(ids, e.stateID())
+	target := max(0, min(i+n, len(ids)-1))
+	if target == i {
+		if n < 0 {
+			e.message = "already at the oldest state"
+		} else {
+			e.message = "already at the newest state"
+		}
+		return
+	}
+	e.gotoState(ids[target])
+	e.message = e.describeState(ids[target])
+}
+
+// when a state was made, the text as it was opened counts as made with the first edit
+func (e *Editor) stateTime(id int) time.Time {
+	if id == 0 && len(e.history) > 0 {
+		return e.history[0].Time
+	}
+	action, _ := e.action(id)
+	return action.Time
+}
+
+// going to the newest state made at or before d after the current one was, so a
+// negative d goes back in time. Like older and newer it goes across branches.
+func (e *Editor) stepTime(d time.Duration) {
+	if e.refuseEdit() {
+		return
+	}
+	current := e.stateID()
+	when := e.stateTime(current).Add(d)
+	ids := e.stateIDs()
+	target := 0
+	for _, id := range ids {
+		if id != 0 && !e.stateTime(id).After(when) {
+			target = id
+		}
+	}
+	if target == current {
+		switch {
+		case d < 0:
+			e.message = "already at the oldest state"
+		case current == ids[len(ids)-1]:
+			e.message = "already at the newest state"
+		default:
+			e.message = "nothing was changed within " + d.String() + " after this state"
+		}
+		return
+	}
+	e.gotoState(target)
+	e.message = e.describeState(target)
+}
+
+// reading how far to move in time, as Go writes durations (90s, 10m, 1h30m) or in days (2d)
+func parseAge(text string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(text, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		return time.Duration(n * float64(24*time.Hour)), err
+	}
+	return time.ParseDuration(text)
+}
+
+// a line about a state for the stat bar and the tree browser
+func (e *Editor) describeState(id int) string {
+	if id == 0 {
+		return "0 the text as it was opened"
+	}
+	path := e.pathTo(id)
+	last := path[len(path)-1]
+	// the actions of the state's group
+	first := len(path) - 1
+	for first > 0 && path[first-1].group == last.group {
+		first--
+	}
+	return strconv.Itoa(id) + " " + last.Time.Format("15:04:05") + " " + summarize(path[first:])
+}
+
+// what a group of actions did, in a few words
+func summarize(actions []Action) string {
+	if len(actions) == 1 || allTyped(actions) {
+		removed, inserted := "", ""
+		for _, action := range actions {
+			removed += action.Removed
+			inserted += action.Inserted
+		}
+		switch {
+		case removed == "":
+			return "+" + quote(inserted)
+		case inserted == "":
+			return "-" + quote(removed)
+		}
+		return quote(removed) + " -> " + quote(inserted)
+	}
+	return strconv.Itoa(len(actions)) + " edits, " + summarize(actions[:1])
+}
+
+// whether actions are characters typed one after another
+func allTyped(actions []Action) bool {
+	for i, action := range actions {
+		if !typed(action) || i > 0 && action.Offset != actions[i-1].Offset+len(actions[i-1].Inserted) {
+			return false
+		}
+	}
+	return true
+}
+
+// a short quoted piece of text, with line breaks and tabs written out
+func quote(text string) string {
+	const most = 24
+	if utf8.RuneCountInString(text) > most {
+		text = string([]rune(text)[:most]) + "…"
+	}
+	return strconv.Quote(text)
+}
+
+// the rows of the tree browser, each state with how far it is indented
+type undoRow struct {
+	id    int
+	depth int
+}
+
+// laying out the tree with the oldest branch going straight down and newer
+// ones indented under the state they split from
+func undoRows(root *undoState) []undoRow {
+	var rows []undoRow
+	type item struct {
+		state *undoState
+		depth int
+	}
+	stack := []item{{root, 0}}
+	for len(stack) > 0 {
+		it := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		rows = append(rows, undoRow{it.state.id, it.depth})
+		// pushed newest first so the oldest comes off the stack next
+		for i := len(it.state.children) - 1; i >= 0; i-- {
+			depth := it.depth
+			if i > 0 {
+				depth++
+			}
+			stack = append(stack, item{it.state.children[i], depth})
+		}
+	}
+	return rows
+}
+
+// showing the undo tree full screen. Moving through it takes the buffer to the
+// state that is selected and shows it on the right, Enter stays there and Esc
+// goes back to where the buffer was.
+func (e *Editor) UndoTree() {
+	if e.hex != nil {
+		e.message = "the undo tree doesn't work in the hex view, Ctrl+Z and Ctrl+Y do"
+		return
+	}
+	if e.refuseEdit() {
+		return
+	}
+	start := e.stateID()
+	rows := undoRows(e.undoTree())
+	selected, top := 0, 0
+	for i, row := range rows {
+		if row.id == start {
+			selected = i
+		}
+	}
+	for {
+		width, height := termbox.Size()
+		lines := height - 1
+		listWidth := min(width/2, 48)
+		// keep the selected state on the screen
+		if selected < top {
+			top = selected
+		} else if selected >= top+lines {
+			top = selected - lines + 1
+		}
+		termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+		for i := 0; i < lines && top+i < len(rows); i++ {
+			row := rows[top+i]
+			mark := "  "
+			switch {
+			case row.id == start:
+				mark = "* "
+			case row.id == e.savedID:
+				mark = "s "
+			}
+			fg, bg := termbox.ColorDefault, termbox.ColorDefault
+			if top+i == selected {
+				fg, bg = termbox.ColorBlack, termbox.ColorWhite
+				for j := 0; j < listWidth; j++ {
+					termbox.SetCell(j, i, ' ', fg, bg)
+				}
+			}
+			drawString(0, i, listWidth, mark+strings.Repeat("  ", row.depth)+e.describeState(row.id), fg, bg)
+		}
+		e.drawPreview(listWidth, width, lines)
+		for j := 0; j < width; j++ {
+			termbox.SetCell(j, height-1, ' ', termbox.ColorBlack, termbox.ColorWhite)
+		}
+		status := "undo tree (* where you were, s saved) | Enter to stay at this state, Esc to go back"
+		drawString(0, height-1, width, status, termbox.ColorBlack, termbox.ColorWhite)
+		termbox.HideCursor()
+		termbox.Flush()
+
+		ev := pollEvent()
+		if ev.Type == termbox.EventError {
+			e.gotoState(start)
+			return
+		}
+		if ev.Type != termbox.EventKey {
+			continue
+		}
+		switch {
+		case ev.Key == termbox.KeyEsc || ev.Ch == 'q':
+			e.gotoState(start)
+			return
+		case ev.Key == termbox.KeyEnter:
+			e.message = e.describeState(rows[selected].id)
+			return
+		case ev.Key == termbox.KeyArrowUp && selected > 0:
+			selected--
+		case ev.Key == termbox.KeyArrowDown && selected < len(rows)-1:
+			selected++
+		case ev.Key == termbox.KeyPgup:
+			selected = max(selected-lines, 0)
+		case ev.Key == termbox.KeyPgdn:
+			selected = min(selected+lines, len(rows)-1)
+		}
+		e.gotoState(rows[selected].id)
+	}
+}
+
+// drawing the lines of the buffer around the cursor between x and maxX, with the cursor line highlighted
+func (e *Editor) drawPreview(x, maxX, lines int) {
+	for i := 0; i < lines; i++ {
+		termbox.SetCell(x, i, '│', termbox.ColorBlue, termbox.ColorDefault)
+	}
+	cursor := e.cursorY + e.offsetY
+	first := max(0, cursor-lines/2)
+	for i := 0; i < lines && e.buffer.HasLine(first+i); i++ {
+		color := termbox.ColorDefault
+		if first+i == cursor {
+			color = termbox.ColorYellow
+		}
+		line := strings.ReplaceAll(e.buffer.Line(first+i), "\t", strings.Repeat(" ", e.tabWidth()))
+		drawString(x+2, i, maxX, line, color, termbox.ColorDefault)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// making a tree with two branches from the empty text: "one" and then "two"
+func branchedEditor() *Editor {
+	e := testEditor("")
+	e.edit(0, 0, "one")
+	e.Undo()
+	e.edit(0, 0, "two")
+	return e
+}
+
+func TestUndoKeepsBranches(t *testing.T) {
+	e := branchedEditor()
+	for _, test := range []struct {
+		id   int
+		want string
+	}{{1, "one"}, {2, "two"}, {0, ""}, {1, "one"}} {
+		e.gotoState(test.id)
+		if got := e.buffer.String(); got != test.want {
+			t.Errorf("at state %d got %q, want %q", test.id, got, test.want)
+		}
+		if e.stateID() != test.id {
+			t.Errorf("going to state %d ended at %d", test.id, e.stateID())
+		}
+	}
+}
+
+func TestGotoStateEverywhere(t *testing.T) {
+	e := testEditor("line one\nline two\n")
+	texts := map[int]string{0: e.buffer.String()}
+	// edits on top of each other with undos in between make a bushy tree
+	edits := []func(){
+		func() { e.edit(0, 4, "LINE") },
+		func() { e.edit(5, 3, "1\nand more") },
+		func() { e.Undo() },
+		func() { e.edit(e.buffer.Len(), 0, "three\n") },
+		func() { e.Undo(); e.Undo() },
+		func() { e.replaceAll("line", "row") },
+		func() { e.edit(0, 0, "# ") },
+		func() { e.Undo() },
+		func() { e.edit(3, 2, "") },
+	}
+	for _, edit := range edits {
+		edit()
+		texts[e.stateID()] = e.buffer.String()
+	}
+	for _, id := range e.stateIDs() {
+		want, ok := texts[id]
+		if !ok {
+			continue
+		}
+		e.gotoState(id)
+		if got := e.buffer.String(); got != want {
+			t.Errorf("at state %d got %q, want %q", id, got, want)
+		}
+	}
+	if len(e.stateIDs()) != len(texts) {
+		t.Errorf("the tree has %d states, want %d", len(e.stateIDs()), len(texts))
+	}
+}
+
+func TestOlderNewer(t *testing.T) {
+	e := branchedEditor()
+	for _, test := range []struct {
+		n    int
+		want string
+	}{{-1, "one"}, {-1, ""}, {-1, ""}, {2, "two"}, {1, "two"}} {
+		e.stepState(test.n)
+		if got := e.buffer.String(); got != test.want {
+			t.Errorf("after stepping %d got %q, want %q", test.n, got, test.want)
+		}
+	}
+}
+
+func TestNextBranch(t *testing.T) {
+	e := branchedEditor()
+	e.Undo()
+	e.Redo()
+	if got := e.buffer.String(); got != "two" {
+		t.Fatalf("redo followed the old branch to %q", got)
+	}
+	e.Undo()
+	e.nextBranch()
+	e.Redo()
+	if got := e.buffer.String(); got != "one" {
+		t.Fatalf("redo after switching branch got %q, want %q", got, "one")
+	}
+}
+
+func TestUndoTreeRows(t *testing.T) {
+	e := branchedEditor()
+	// a typed word is one state
+	e.Undo()
+	typeText(e, "three")
+	rows := undoRows(e.undoTree())
+	want := []undoRow{{0, 0}, {1, 0}, {2, 1}, {e.stateID(), 1}}
+	if len(rows) != len(want) {
+		t.Fatalf("got rows %v, want %v", rows, want)
+	}
+	for i := range want {
+		if rows[i] != want[i] {
+			t.Errorf("row %d is %v, want %v", i, rows[i], want[i])
+		}
+	}
+	if got, want := summarize(e.UndoBuffer), `+"three"`; got != want {
+		t.Errorf("the typed word is summarized as %s, want %s", got, want)
+	}
+}
+
+// making an edit as if it was made at a time
+func editAt(e *Editor, when time.Time, offset int, text string) {
+	e.edit(offset, 0, text)
+	e.history[len(e.history)-1].Time = when
+	e.UndoBuffer[len(e.UndoBuffer)-1].Time = when
+}
+
+func TestEarlierLater(t *testing.T) {
+	start := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	e := testEditor("")
+	editAt(e, start, 0, "a")
+	editAt(e, start.Add(time.Minute), 1, "b")
+	editAt(e, start.Add(5*time.Minute), 2, "c")
+	editAt(e, start.Add(20*time.Minute), 3, "d")
+	for _, test := range []struct {
+		d    time.Duration
+		want string
+	}{
+		{-10 * time.Minute, "abc"},
+		{-10 * time.Minute, ""},
+		{-time.Minute, ""},
+		{2 * time.Minute, "ab"},
+		{time.Minute, "ab"},
+		{time.Hour, "abcd"},
+		{-30 * time.Second, "abc"},
+	} {
+		e.stepTime(test.d)
+		if got := e.buffer.String(); got != test.want {
+			t.Errorf("after moving %v got %q, want %q", test.d, got, test.want)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	for text, want := range map[string]time.Duration{
+		"10m":   10 * time.Minute,
+		"90s":   90 * time.Second,
+		"1h30m": 90 * time.Minute,
+		"2d":    48 * time.Hour,
+		"0.5d":  12 * time.Hour,
+	} {
+		got, err := parseAge(text)
+		if err != nil || got != want {
+			t.Errorf("parseAge(%q) = %v, %v, want %v", text, got, err, want)
+		}
+	}
+	if _, err := parseAge("soon"); err == nil {
+		t.Error("parseAge accepted soon")
+	}
+}
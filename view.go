@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+// showing lines of text full screen until Esc or q is pressed, lines of a diff are coloured
+func (e *Editor) ShowText(title string, lines []string) {
+	top := 0
+	for {
+		width, height := termbox.Size()
+		termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+		for i := 0; i < height-1 && top+i < len(lines); i++ {
+			line := lines[top+i]
+			color := termbox.ColorDefault
+			switch {
+			case strings.HasPrefix(line, "@@"):
+				color = termbox.ColorCyan
+			case strings.HasPrefix(line, "+"):
+				color = termbox.ColorGreen
+			case strings.HasPrefix(line, "-"):
+				color = termbox.ColorRed
+			}
+			drawString(0, i, width, strings.ReplaceAll(line, "\t", "    "), color, termbox.ColorDefault)
+		}
+		for j := 0; j < width; j++ {
+			termbox.SetCell(j, height-1, ' ', termbox.ColorBlack, termbox.ColorWhite)
+		}
+		drawString(0, height-1, width, title+" | arrows to scroll, Esc to close", termbox.ColorBlack, termbox.ColorWhite)
+		termbox.HideCursor()
+		termbox.Flush()
+
+		ev := pollEvent()
+		if ev.Type == termbox.EventError {
+			return
+		}
+		if ev.Type != termbox.EventKey {
+			continue
+		}
+		switch {
+		case ev.Key == termbox.KeyEsc || ev.Ch == 'q':
+			return
+		case ev.Key == termbox.KeyArrowUp && top > 0:
+			top--
+		case ev.Key == termbox.KeyArrowDown && top < len(lines)-1:
+			top++
+		case ev.Key == termbox.KeyPgup:
+			top = max(top-(height-1), 0)
+		case ev.Key == termbox.KeyPgdn:
+			top = max(min(top+(height-1), len(lines)-1), 0)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+	"github.com/rivo/uniseg"
+)
+
+// Columns in the buffer are byte offsets into a line, but the cursor only ever
+// stops between grapheme clusters (what the user sees as one character) and
+// the screen is laid out using the display width of each cluster. A tab is as
+// wide as it needs to be to reach the next tab stop, so widths are always
+// measured from the start of a line.
+
+// the number of cells a grapheme cluster takes up on the screen
+func clusterWidth(cluster string) int {
+	width := runewidth.StringWidth(cluster)
+	if width < 1 {
+		// control characters and lone combining marks still get a cell so the cursor can reach them
+		return 1
+	}
+	return width
+}
+
+// the number of cells a grapheme cluster takes up when it starts cells into the line
+func cellWidth(cluster string, cells, tabWidth int) int {
+	if cluster == "\t" {
+		return tabWidth - cells%tabWidth
+	}
+	return clusterWidth(cluster)
+}
+
+// the rune that is drawn for a grapheme cluster, termbox can only draw one rune per cell
+func clusterRune(cluster string) rune {
+	r, _ := utf8.DecodeRuneInString(cluster)
+	if r == utf8.RuneError || unicode.IsControl(r) {
+		return '?'
+	}
+	return r
+}
+
+// the number of cells text from the start of a line takes up on the screen
+func displayWidth(text string, tabWidth int) int {
+	width := 0
+	g := uniseg.NewGraphemes(text)
+	for g.Next() {
+		width += cellWidth(g.Str(), width, tabWidth)
+	}
+	return width
+}
+
+// the number of characters in text
+func clusterCount(text string) int {
+	return uniseg.GraphemeClusterCount(text)
+}
+
+// the start of the character before col
+func prevBoundary(text string, col int) int {
+	prev := 0
+	g := uniseg.NewGraphemes(text)
+	for g.Next() {
+		start, _ := g.Positions()
+		if start >= col {
+			break
+		}
+		prev = start
+	}
+	return prev
+}
+
+// the end of the character that starts at col
+func nextBoundary(text string, col int) int {
+	g := uniseg.NewGraphemes(text)
+	for g.Next() {
+		_, end := g.Positions()
+		if end > col {
+			return end
+		}
+	}
+	return len(text)
+}
+
+// the column of the character that is width cells into a line, or the end of the line
+func colAtWidth(text string, width, tabWidth int) int {
+	cells := 0
+	g := uniseg.NewGraphemes(text)
+	for g.Next() {
+		start, _ := g.Positions()
+		cells += cellWidth(g.Str(), cells, tabWidth)
+		if cells > width {
+			return start
+		}
+	}
+	return len(text)
+}
+
+// writing text to the screen from x, stopping before maxX, and returning where it ended
+func drawString(x, y, maxX int, text string, fg, bg termbox.Attribute) int {
+	g := uniseg.NewGraphemes(text)
+	for g.Next() {
+		width := clusterWidth(g.Str())
+		if x+width > maxX {
+			break
+		}
+		termbox.SetCell(x, y, clusterRune(g.Str()), fg, bg)
+		x += width
+	}
+	return x
+}